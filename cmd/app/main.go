@@ -1,18 +1,31 @@
 package main
 
 import (
+	"context"
 	"crypto/tls" // Import for TLS configuration
 	"flag"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/Hiwiii/snippetbox.git/config"
+	"github.com/Hiwiii/snippetbox.git/internal/assets"
+	"github.com/Hiwiii/snippetbox.git/internal/audit"
+	"github.com/Hiwiii/snippetbox.git/internal/expiry"
+	"github.com/Hiwiii/snippetbox.git/internal/i18n"
+	"github.com/Hiwiii/snippetbox.git/internal/mailer"
 	"github.com/Hiwiii/snippetbox.git/internal/middleware"
 	"github.com/Hiwiii/snippetbox.git/internal/models"
+	"github.com/Hiwiii/snippetbox.git/internal/notifier"
+	"github.com/Hiwiii/snippetbox.git/internal/oidc"
+	"github.com/Hiwiii/snippetbox.git/internal/ratelimit"
 	"github.com/Hiwiii/snippetbox.git/internal/routes"
+	"github.com/Hiwiii/snippetbox.git/internal/secrets"
 	"github.com/Hiwiii/snippetbox.git/internal/templates"
+	"github.com/Hiwiii/snippetbox.git/ui"
 	"github.com/alexedwards/scs/mysqlstore"
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
@@ -22,6 +35,27 @@ func main() {
 	// Define flags for the server address and DSN (data source name)
 	addr := flag.String("addr", ":4000", "HTTP network address")
 	dsn := flag.String("dsn", "web:Secure@123@tcp(localhost:3306)/snippetbox?parseTime=true", "MySQL DSN")
+	expiryPresets := flag.String("expiry-presets", "24h,168h,8760h", "Comma-separated snippet expiry durations offered on the create form")
+	allowNeverExpire := flag.Bool("allow-never-expire", false, "Allow admins to create snippets that never expire")
+	baseURL := flag.String("base-url", "https://localhost:4000", "Public URL of the site, used for links in emails and the single sign-on callback")
+	smtpHost := flag.String("smtp-host", "", "SMTP server host (emails are written to stdout if empty)")
+	smtpPort := flag.Int("smtp-port", 25, "SMTP server port")
+	smtpUsername := flag.String("smtp-username", "", "SMTP username")
+	smtpPassword := flag.String("smtp-password", "", "SMTP password")
+	smtpSender := flag.String("smtp-sender", "Snippetbox <no-reply@snippetbox.local>", "SMTP sender")
+	notifyBefore := flag.Duration("notify-before", 24*time.Hour, "How long before expiry to email snippet creators")
+	notifyInterval := flag.Duration("notify-interval", 5*time.Minute, "How often to check for snippets about to expire")
+	oidcIssuer := flag.String("oidc-issuer", "", "OpenID Connect issuer URL (single sign-on is disabled if empty)")
+	oidcClientID := flag.String("oidc-client-id", "", "OpenID Connect client ID")
+	oidcClientSecret := flag.String("oidc-client-secret", "", "OpenID Connect client secret")
+	oidcRedirectURL := flag.String("oidc-redirect-url", "", "OpenID Connect redirect URL (defaults to the callback under -base-url)")
+	oidcAllowedDomains := flag.String("oidc-allowed-domains", "", "Comma-separated email domains allowed to log in (any if empty)")
+	secretRules := flag.String("secret-rules", secrets.DefaultRules, "Comma-separated rules used to warn about secrets in new snippets (entropy takes an optional threshold, e.g. entropy:4.8)")
+	reportLimit := flag.Int("report-limit", 3, "Number of independent reports after which a snippet is hidden until moderated")
+	dev := flag.Bool("dev", false, "Development mode: reload templates from -ui-dir (./ui by default) when they change and show template errors in the browser")
+	uiDir := flag.String("ui-dir", "", "Serve templates and static files from this directory instead of the copies built into the binary, e.g. ./ui while developing")
+	adminEmails := flag.String("admin-emails", "", "Comma-separated email addresses of users who are made admins when they log in")
+	defaultLocale := flag.String("default-locale", "en", "Locale used for visitors whose browsers accept none of the translations")
 	flag.Parse()
 
 	// Create loggers
@@ -38,12 +72,83 @@ func main() {
 	// Initialize the SnippetModel with the database connection
 	snippetModel := &models.SnippetModel{DB: db}
 
-	// Initialize a new template cache
-	templateCache, err := templates.NewTemplateCache()
+	// Parse the expiry presets offered when creating a snippet
+	presets, err := expiry.ParsePresets(*expiryPresets)
+	if err != nil {
+		errorLog.Fatalf("Invalid expiry presets: %v", err)
+	}
+
+	// Set up the rules used to catch secrets pasted into snippets
+	secretDetector, err := secrets.ParseRules(*secretRules)
+	if err != nil {
+		errorLog.Fatalf("Invalid secret rules: %v", err)
+	}
+
+	// Use the ui directory built into the binary, unless one on disk was given.
+	// Development mode always reads it from disk.
+	if *dev && *uiDir == "" {
+		*uiDir = "./ui"
+	}
+	var uiFiles fs.FS = ui.Files
+	if *uiDir != "" {
+		uiFiles = os.DirFS(*uiDir)
+	}
+	staticFiles, err := fs.Sub(uiFiles, "static")
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	staticAssets, err := assets.New(staticFiles, *dev)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	mailTemplates, err := fs.Sub(uiFiles, "mail")
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	// Load the message catalogs
+	localeFiles, err := fs.Sub(uiFiles, "locales")
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	bundle, err := i18n.Load(localeFiles, *defaultLocale)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	// Initialize a new template cache for each locale
+	templateCache, err := templates.NewLocaleCache(uiFiles, staticAssets.Path, bundle)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// Discover the single sign-on provider, if one is configured
+	var provider *oidc.Provider
+	if *oidcIssuer != "" {
+		redirectURL := *oidcRedirectURL
+		if redirectURL == "" {
+			redirectURL = strings.TrimSuffix(*baseURL, "/") + "/login/oidc/callback"
+		}
+
+		var allowedDomains []string
+		if *oidcAllowedDomains != "" {
+			allowedDomains = strings.Split(*oidcAllowedDomains, ",")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		provider, err = oidc.New(ctx, oidc.Config{
+			Issuer:         *oidcIssuer,
+			ClientID:       *oidcClientID,
+			ClientSecret:   *oidcClientSecret,
+			RedirectURL:    redirectURL,
+			AllowedDomains: allowedDomains,
+		})
+		cancel()
+		if err != nil {
+			errorLog.Fatalf("Unable to set up single sign-on: %v", err)
+		}
+	}
+
 	// Initialize the session manager
 	sessionManager := scs.New()
 	sessionManager.Store = mysqlstore.New(db)
@@ -56,17 +161,81 @@ func main() {
 		ErrorLog:       errorLog,
 		DB:             db,
 		SnippetModel:   snippetModel,
+		TagModel:       &models.TagModel{DB: db},
+		CommentModel:   &models.CommentModel{DB: db},
+		StarModel:      &models.StarModel{DB: db},
+		UserModel:      &models.UserModel{DB: db},
+		TwoFactorModel: &models.TwoFactorModel{DB: db},
+		StatsModel:     &models.StatsModel{DB: db},
+		ReportModel:    &models.ReportModel{DB: db},
+		Moderation:     &models.ModerationModel{DB: db},
 		TemplateCache:  templateCache,
+		Assets:         staticAssets,
 		FormDecoder:    form.NewDecoder(),
 		SessionManager: sessionManager,
+		// Allow 5 snippet password guesses per client and snippet every 15 minutes.
+		UnlockLimiter: ratelimit.New(5, 15*time.Minute),
+		// Allow 5 two-factor codes per user every 15 minutes.
+		LoginLimiter: ratelimit.New(5, 15*time.Minute),
+		ExpiryPolicy: &expiry.Policy{
+			Presets:    presets,
+			AllowNever: *allowNeverExpire,
+			Now:        time.Now,
+		},
+		OIDC:        provider,
+		AdminEmails: make(map[string]bool),
+		ReportLimit: *reportLimit,
+		Secrets:     secretDetector,
+		Auditor: &audit.Auditor{
+			Store: &models.AuditModel{DB: db},
+			Now:   time.Now,
+		},
 	}
 
+	// Normalize the addresses of users who are made admins when they log in
+	for _, email := range strings.Split(*adminEmails, ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			app.AdminEmails[strings.ToLower(email)] = true
+		}
+	}
+
+	// Send expiry reminders through SMTP, or log them when no server is configured
+	var mail mailer.Mailer = &mailer.LogMailer{Writer: os.Stdout, Sender: *smtpSender}
+	if *smtpHost != "" {
+		mail = &mailer.SMTPMailer{
+			Host:     *smtpHost,
+			Port:     *smtpPort,
+			Username: *smtpUsername,
+			Password: *smtpPassword,
+			Sender:   *smtpSender,
+		}
+	}
+
+	// Start emailing creators whose snippets are about to expire
+	expiryNotifier := &notifier.ExpiryNotifier{
+		Snippets:  snippetModel,
+		Mailer:    mail,
+		Templates: mailTemplates,
+		BaseURL:   strings.TrimSuffix(*baseURL, "/"),
+		Before:    *notifyBefore,
+		Now:       time.Now,
+		ErrorLog:  errorLog,
+		Auditor:   app.Auditor,
+	}
+	go expiryNotifier.Run(context.Background(), *notifyInterval)
+
 	// Initialize the Helpers struct
 	helpers := &middleware.Helpers{
 		ErrorLog:       errorLog,
 		TemplateCache:  templateCache,
 		FormDecoder:    form.NewDecoder(),
 		SessionManager: sessionManager,
+		LoginEnabled:   provider != nil,
+		I18n:           bundle,
+	}
+	if *dev {
+		helpers.TemplateReloader = templates.NewReloader(uiFiles, staticAssets.Path, bundle)
+		infoLog.Printf("Development mode: reloading templates from %s", *uiDir)
 	}
 
 	// Configure the TLS settings
@@ -2,10 +2,16 @@ package config
 
 import (
 	"database/sql"
+	"github.com/Hiwiii/snippetbox.git/internal/assets"
+	"github.com/Hiwiii/snippetbox.git/internal/audit"
+	"github.com/Hiwiii/snippetbox.git/internal/expiry"
 	"github.com/Hiwiii/snippetbox.git/internal/models"
+	"github.com/Hiwiii/snippetbox.git/internal/oidc"
+	"github.com/Hiwiii/snippetbox.git/internal/ratelimit"
+	"github.com/Hiwiii/snippetbox.git/internal/secrets"
+	"github.com/Hiwiii/snippetbox.git/internal/templates"
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
-	"html/template"
 	"log"
 )
 
@@ -14,8 +20,25 @@ type Application struct {
 	InfoLog        *log.Logger
 	ErrorLog       *log.Logger
 	DB             *sql.DB
-	SnippetModel   *models.SnippetModel
-	TemplateCache  map[string]*template.Template
+	SnippetModel   SnippetStore
+	TagModel       *models.TagModel
+	CommentModel   CommentStore
+	StarModel      StarStore
+	UserModel      UserStore
+	TwoFactorModel *models.TwoFactorModel
+	StatsModel     *models.StatsModel
+	ReportModel    *models.ReportModel
+	Moderation     *models.ModerationModel
+	TemplateCache  templates.LocaleCache
+	Assets         *assets.Server
 	FormDecoder    *form.Decoder
 	SessionManager *scs.SessionManager
+	UnlockLimiter  *ratelimit.Limiter
+	LoginLimiter   *ratelimit.Limiter // two-factor codes entered per user
+	ExpiryPolicy   *expiry.Policy
+	OIDC           *oidc.Provider  // nil if single sign-on isn't configured
+	AdminEmails    map[string]bool // users with these verified addresses are made admins
+	ReportLimit    int             // open reports after which a snippet is hidden automatically
+	Secrets        *secrets.Detector
+	Auditor        *audit.Auditor
 }
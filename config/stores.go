@@ -0,0 +1,59 @@
+package config
+
+import (
+	"time"
+
+	"github.com/Hiwiii/snippetbox.git/internal/models"
+)
+
+// SnippetStore is the part of models.SnippetModel used by the handlers. The
+// Application holds it as an interface so that handler tests can run without
+// a database.
+type SnippetStore interface {
+	Insert(s *models.Snippet, password string, maxViews int) (int, error)
+	Get(id int) (*models.Snippet, error)
+	GetIncludingHidden(id int) (*models.Snippet, error)
+	GetMany(ids []int) ([]*models.Snippet, error)
+	Extend(id int, expires time.Time) error
+	Consume(id int) (*models.Snippet, error)
+	ManageTokenMatches(id int, token string) (bool, error)
+	Exists(id int) (bool, error)
+	Forks(id int) ([]*models.Snippet, error)
+	Latest(tag string) ([]*models.Snippet, error)
+	ByUser(userID int, includeUnlisted bool, limit, offset int) ([]*models.Snippet, error)
+	Search(q string) ([]*models.Snippet, error)
+	SetHidden(id int, hidden bool) error
+	Delete(id int) error
+}
+
+// CommentStore is the part of models.CommentModel used by the handlers.
+type CommentStore interface {
+	Insert(c *models.Comment) (int, error)
+	Get(id int) (*models.Comment, error)
+	ForSnippet(snippetID int, includeHidden bool) ([]*models.Comment, error)
+	SetHidden(id, snippetID int, hidden bool) error
+	Delete(id, snippetID int) error
+}
+
+// UserStore is the part of models.UserModel used by the handlers and the
+// Authenticate middleware.
+type UserStore interface {
+	Get(id int) (*models.User, error)
+	GetByUsername(username string) (*models.User, error)
+	Search(q string) ([]*models.User, error)
+	LoginOIDC(issuer, subject, name, email string) (int, error)
+	UpdateProfile(id int, name, bio string) error
+	SetAvatar(id int, image []byte, contentType string) error
+	Avatar(username string) ([]byte, string, error)
+	SetRole(id int, role models.Role) error
+	SetDisabled(id int, disabled bool) error
+}
+
+// StarStore is the part of models.StarModel used by the handlers.
+type StarStore interface {
+	Add(userID, snippetID int) error
+	Remove(userID, snippetID int) error
+	Exists(userID, snippetID int) (bool, error)
+	Starred(userID int) ([]*models.Snippet, error)
+	MostStarred(since time.Time, limit int) ([]*models.Snippet, error)
+}
@@ -2,12 +2,14 @@ module github.com/Hiwiii/snippetbox.git
 
 go 1.23.3
 
-require github.com/go-sql-driver/mysql v1.8.1
-
 require (
-	github.com/alexedwards/scs/mysqlstore v0.0.0-20240316134038-7e11d57e8885 // indirect
-	github.com/alexedwards/scs/v2 v2.8.0 // indirect
-	github.com/go-playground/form/v4 v4.2.1 // indirect
+	github.com/alexedwards/scs/mysqlstore v0.0.0-20240316134038-7e11d57e8885
+	github.com/alexedwards/scs/v2 v2.8.0
+	github.com/andybalholm/brotli v1.2.6
+	github.com/go-playground/form/v4 v4.2.1
+	github.com/go-sql-driver/mysql v1.8.1
+	github.com/klauspost/compress v1.17.11
+	golang.org/x/crypto v0.33.0
 )
 
 require (
@@ -0,0 +1,384 @@
+package assets
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Hiwiii/snippetbox.git/internal/negotiate"
+
+	"github.com/andybalholm/brotli"
+)
+
+// immutable is the Cache-Control header for fingerprinted URLs. Their content
+// never changes, since a new version of a file gets a new URL.
+const immutable = "public, max-age=31536000, immutable"
+
+// compressible lists the extensions of files worth compressing. Images other
+// than icons and SVGs are already compressed.
+var compressible = map[string]bool{
+	".css":  true,
+	".js":   true,
+	".svg":  true,
+	".ico":  true,
+	".txt":  true,
+	".json": true,
+	".map":  true,
+	".html": true,
+}
+
+// contentTypes fixes the types of common static files. mime.TypeByExtension
+// reads the host's MIME tables, which differ between systems, so it is only
+// used for other extensions.
+var contentTypes = map[string]string{
+	".css":   "text/css; charset=utf-8",
+	".js":    "text/javascript; charset=utf-8",
+	".mjs":   "text/javascript; charset=utf-8",
+	".json":  "application/json",
+	".map":   "application/json",
+	".html":  "text/html; charset=utf-8",
+	".txt":   "text/plain; charset=utf-8",
+	".svg":   "image/svg+xml",
+	".png":   "image/png",
+	".jpg":   "image/jpeg",
+	".jpeg":  "image/jpeg",
+	".gif":   "image/gif",
+	".webp":  "image/webp",
+	".avif":  "image/avif",
+	".ico":   "image/vnd.microsoft.icon",
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+	".pdf":   "application/pdf",
+}
+
+// variant is one encoding of a file's content.
+type variant struct {
+	encoding string // "" for the original
+	etag     string
+	content  []byte
+}
+
+// asset is a file along with its precompressed variants.
+type asset struct {
+	name        string // e.g. "css/main.css"
+	contentType string
+	fingerprint string // e.g. "css/main.1a2b3c4d5e.css"
+	variants    []*variant
+	modTime     time.Time
+}
+
+// index holds every asset, by original name and by fingerprinted name.
+type index struct {
+	assets        map[string]*asset
+	fingerprinted map[string]*asset
+	stamp         string
+}
+
+// Server serves static files. Each file is available at its own path and at
+// a fingerprinted path containing a hash of its content; Path returns the
+// latter for use in templates. Fingerprinted responses can be cached forever,
+// and other responses are revalidated with an ETag. Compressible files are
+// compressed with brotli and gzip once, when the Server is created.
+type Server struct {
+	fsys   fs.FS
+	reload bool
+
+	mu    sync.Mutex // serializes reloads
+	index atomic.Pointer[index]
+}
+
+// New returns a Server for the files in fsys. If reload is true the files
+// are hashed again whenever one of them changes, which is meant for
+// development; otherwise they are read once.
+func New(fsys fs.FS, reload bool) (*Server, error) {
+	s := &Server{fsys: fsys, reload: reload}
+
+	idx, err := build(fsys)
+	if err != nil {
+		return nil, err
+	}
+	s.index.Store(idx)
+
+	return s, nil
+}
+
+// Path returns the fingerprinted URL of the named file, such as
+// "/static/css/main.1a2b3c4d5e.css" for "css/main.css". Unknown files get
+// their plain URL, so a typo shows up as a 404 rather than a template error.
+func (s *Server) Path(name string) string {
+	name = strings.TrimPrefix(name, "/")
+
+	if a, ok := s.current().assets[name]; ok {
+		return "/static/" + a.fingerprint
+	}
+	return "/static/" + name
+}
+
+// ServeHTTP serves the file named by the request path, which should have the
+// /static prefix stripped. Directories are served by their index.html file,
+// if they have one, and are never listed. Dotfiles are never served.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	idx := s.current()
+	name := strings.TrimPrefix(r.URL.Path, "/")
+
+	if hidden(name) {
+		http.NotFound(w, r)
+		return
+	}
+
+	if name == "" || strings.HasSuffix(name, "/") {
+		name += "index.html"
+	} else if _, ok := idx.assets[name+"/index.html"]; ok {
+		// Like http.FileServer, send directories to their canonical URL so
+		// that relative links in the index work. The Location is relative
+		// because the /static prefix has been stripped from the path.
+		w.Header().Set("Location", path.Base(name)+"/")
+		w.WriteHeader(http.StatusMovedPermanently)
+		return
+	}
+
+	a, ok := idx.fingerprinted[name]
+	if ok {
+		w.Header().Set("Cache-Control", immutable)
+	} else if a, ok = idx.assets[name]; ok {
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Byte ranges refer to the file itself, so range requests always get the
+	// uncompressed content.
+	v := a.variants[0]
+	if len(a.variants) > 1 {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Header.Get("Range") == "" {
+			v = a.negotiate(r.Header.Get("Accept-Encoding"))
+		}
+	}
+
+	if v.encoding != "" {
+		w.Header().Set("Content-Encoding", v.encoding)
+	}
+	w.Header().Set("Content-Type", a.contentType)
+	w.Header().Set("ETag", v.etag)
+
+	// ServeContent answers If-None-Match using the ETag header, and handles
+	// Range and If-Range.
+	http.ServeContent(w, r, a.name, a.modTime, bytes.NewReader(v.content))
+}
+
+// hidden reports whether any element of a slash-separated path starts with a
+// dot. That covers dotfiles such as .gitignore, files in dot directories, and
+// "." and ".." elements.
+func hidden(name string) bool {
+	for _, elem := range strings.Split(name, "/") {
+		if strings.HasPrefix(elem, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiate returns the variant preferred by an Accept-Encoding header,
+// falling back to the original.
+func (a *asset) negotiate(header string) *variant {
+	offers := make([]string, 0, len(a.variants)-1)
+	for _, v := range a.variants[1:] {
+		offers = append(offers, v.encoding)
+	}
+
+	encoding := negotiate.Encoding(header, offers...)
+	for _, v := range a.variants[1:] {
+		if v.encoding == encoding {
+			return v
+		}
+	}
+	return a.variants[0]
+}
+
+// current returns the index, rebuilding it first in reload mode if any file
+// has changed. Errors while reloading keep the previous index.
+func (s *Server) current() *index {
+	idx := s.index.Load()
+	if !s.reload {
+		return idx
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx = s.index.Load()
+	stamp, err := fingerprintTree(s.fsys)
+	if err != nil || stamp == idx.stamp {
+		return idx
+	}
+
+	if fresh, err := build(s.fsys); err == nil {
+		s.index.Store(fresh)
+		idx = fresh
+	}
+	return idx
+}
+
+// build reads, hashes and compresses every file in fsys.
+func build(fsys fs.FS) (*index, error) {
+	idx := &index{
+		assets:        make(map[string]*asset),
+		fingerprinted: make(map[string]*asset),
+	}
+
+	stamp, err := fingerprintTree(fsys)
+	if err != nil {
+		return nil, err
+	}
+	idx.stamp = stamp
+
+	err = fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name != "." && hidden(name) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		a, err := newAsset(name, content, info.ModTime())
+		if err != nil {
+			return fmt.Errorf("assets: %s: %w", name, err)
+		}
+
+		idx.assets[a.name] = a
+		idx.fingerprinted[a.fingerprint] = a
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return idx, nil
+}
+
+// newAsset hashes a file and compresses it if that makes it smaller.
+func newAsset(name string, content []byte, modTime time.Time) (*asset, error) {
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:5])
+
+	// The fingerprinted name keeps the extension as it is, but the type and
+	// whether to compress don't depend on its case.
+	ext := path.Ext(name)
+	kind := strings.ToLower(ext)
+	contentType := contentTypes[kind]
+	if contentType == "" {
+		contentType = mime.TypeByExtension(ext)
+	}
+	if contentType == "" {
+		// Don't guess from the content: a file that looks like HTML
+		// mustn't be served as HTML.
+		contentType = "application/octet-stream"
+	}
+
+	a := &asset{
+		name:        name,
+		contentType: contentType,
+		fingerprint: strings.TrimSuffix(name, ext) + "." + hash + ext,
+		modTime:     modTime,
+		variants:    []*variant{{etag: strconv.Quote(hash), content: content}},
+	}
+
+	if !compressible[kind] {
+		return a, nil
+	}
+
+	// Preferred encodings come first.
+	for _, encoding := range []string{"br", "gzip"} {
+		compressed, err := compress(encoding, content)
+		if err != nil {
+			return nil, err
+		}
+		if len(compressed) < len(content)*9/10 {
+			a.variants = append(a.variants, &variant{
+				encoding: encoding,
+				etag:     strconv.Quote(hash + "-" + encoding),
+				content:  compressed,
+			})
+		}
+	}
+
+	return a, nil
+}
+
+// compress compresses content with the best compression available, since it
+// is only done once.
+func compress(encoding string, content []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+
+	switch encoding {
+	case "br":
+		bw := brotli.NewWriterLevel(&buf, brotli.BestCompression)
+		if _, err = bw.Write(content); err == nil {
+			err = bw.Close()
+		}
+	case "gzip":
+		var gw *gzip.Writer
+		gw, err = gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		if err == nil {
+			if _, err = gw.Write(content); err == nil {
+				err = gw.Close()
+			}
+		}
+	default:
+		err = fmt.Errorf("unknown encoding %q", encoding)
+	}
+
+	return buf.Bytes(), err
+}
+
+// fingerprintTree summarises the name, size and modification time of every
+// file in fsys, so that any change gives a different result. Dotfiles are
+// included; they can't be served, so a spurious reload is harmless.
+func fingerprintTree(fsys fs.FS) (string, error) {
+	var b strings.Builder
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "%s %d %d\n", name, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+
+	return b.String(), err
+}
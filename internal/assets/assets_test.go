@@ -0,0 +1,197 @@
+package assets
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+var css = []byte(strings.Repeat("body { color: #333; }\n", 50))
+
+func newTestServer(t *testing.T, reload bool) (*Server, fstest.MapFS) {
+	t.Helper()
+
+	fsys := fstest.MapFS{
+		"css/main.css":    {Data: css},
+		"img/logo.png":    {Data: []byte("\x89PNG\r\n\x1a\n not really")},
+		"js/tiny.js":      {Data: []byte("x")},
+		"img/favicon.ico": {Data: bytes.Repeat([]byte{0}, 1000)},
+	}
+
+	s, err := New(fsys, reload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, fsys
+}
+
+func get(s *Server, path string, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, r)
+	return rr
+}
+
+func TestPath(t *testing.T) {
+	s, _ := newTestServer(t, false)
+
+	p := s.Path("css/main.css")
+	if !strings.HasPrefix(p, "/static/css/main.") || !strings.HasSuffix(p, ".css") || p == "/static/css/main.css" {
+		t.Errorf("got %q; want a fingerprinted path", p)
+	}
+	if got := s.Path("/css/main.css"); got != p {
+		t.Errorf("leading slash: got %q; want %q", got, p)
+	}
+	if got := s.Path("css/missing.css"); got != "/static/css/missing.css" {
+		t.Errorf("got %q for an unknown file", got)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	s, _ := newTestServer(t, false)
+	fingerprinted := strings.TrimPrefix(s.Path("css/main.css"), "/static")
+
+	tests := []struct {
+		name         string
+		path         string
+		encoding     string
+		wantStatus   int
+		wantCache    string
+		wantEncoding string
+	}{
+		{"fingerprinted", fingerprinted, "", http.StatusOK, immutable, ""},
+		{"plain", "/css/main.css", "", http.StatusOK, "no-cache", ""},
+		{"brotli preferred", fingerprinted, "gzip, deflate, br", http.StatusOK, immutable, "br"},
+		{"gzip", fingerprinted, "gzip", http.StatusOK, immutable, "gzip"},
+		{"brotli refused", fingerprinted, "br;q=0, gzip;q=0.5", http.StatusOK, immutable, "gzip"},
+		{"wildcard", fingerprinted, "*", http.StatusOK, immutable, "br"},
+		{"identity only", fingerprinted, "identity", http.StatusOK, immutable, ""},
+		{"not compressible", "/img/logo.png", "br, gzip", http.StatusOK, "no-cache", ""},
+		{"too small to compress", "/js/tiny.js", "br, gzip", http.StatusOK, "no-cache", ""},
+		{"unknown file", "/css/missing.css", "", http.StatusNotFound, "", ""},
+		{"stale fingerprint", "/css/main.0000000000.css", "", http.StatusNotFound, "", ""},
+		{"directory", "/css", "", http.StatusNotFound, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := get(s, tt.path, http.Header{"Accept-Encoding": {tt.encoding}})
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("got status %d; want %d", rr.Code, tt.wantStatus)
+			}
+			if rr.Code != http.StatusOK {
+				return
+			}
+			if got := rr.Header().Get("Cache-Control"); got != tt.wantCache {
+				t.Errorf("got Cache-Control %q; want %q", got, tt.wantCache)
+			}
+			if got := rr.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("got Content-Encoding %q; want %q", got, tt.wantEncoding)
+			}
+
+			var body io.Reader = rr.Body
+			switch tt.wantEncoding {
+			case "br":
+				body = brotli.NewReader(body)
+			case "gzip":
+				gr, err := gzip.NewReader(body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = gr
+			}
+			got, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.HasSuffix(tt.path, ".css") && !bytes.Equal(got, css) {
+				t.Error("decoded body doesn't match the file")
+			}
+		})
+	}
+
+	// Compressed files vary by encoding; others don't.
+	if got := get(s, "/css/main.css", nil).Header().Get("Vary"); got != "Accept-Encoding" {
+		t.Errorf("got Vary %q for a compressed file", got)
+	}
+	if got := get(s, "/img/logo.png", nil).Header().Get("Vary"); got != "" {
+		t.Errorf("got Vary %q for an uncompressed file", got)
+	}
+	if got := get(s, "/css/main.css", nil).Header().Get("Content-Type"); got != "text/css; charset=utf-8" {
+		t.Errorf("got Content-Type %q", got)
+	}
+}
+
+func TestETag(t *testing.T) {
+	s, _ := newTestServer(t, false)
+
+	plain := get(s, "/css/main.css", nil).Header().Get("ETag")
+	br := get(s, "/css/main.css", http.Header{"Accept-Encoding": {"br"}}).Header().Get("ETag")
+	if plain == "" || br == "" || plain == br {
+		t.Fatalf("got ETags %q and %q; want different ETags per encoding", plain, br)
+	}
+
+	rr := get(s, "/css/main.css", http.Header{"If-None-Match": {plain}})
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("got status %d; want 304", rr.Code)
+	}
+	if rr.Body.Len() != 0 {
+		t.Error("304 response has a body")
+	}
+
+	rr = get(s, "/css/main.css", http.Header{"If-None-Match": {`"stale"`}})
+	if rr.Code != http.StatusOK {
+		t.Errorf("got status %d for a stale ETag; want 200", rr.Code)
+	}
+}
+
+func TestExtensionCase(t *testing.T) {
+	a, err := newAsset("css/MAIN.CSS", css, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.contentType != "text/css; charset=utf-8" {
+		t.Errorf("got Content-Type %q; want %q", a.contentType, "text/css; charset=utf-8")
+	}
+	if len(a.variants) < 2 {
+		t.Errorf("got %d variants; want compressed ones too", len(a.variants))
+	}
+	if !strings.HasSuffix(a.fingerprint, ".CSS") {
+		t.Errorf("got fingerprinted name %q; want the extension kept", a.fingerprint)
+	}
+}
+
+func TestReload(t *testing.T) {
+	s, fsys := newTestServer(t, true)
+	before := s.Path("css/main.css")
+
+	fsys["css/main.css"] = &fstest.MapFile{Data: []byte("body { color: red; }"), ModTime: time.Now()}
+	after := s.Path("css/main.css")
+	if after == before {
+		t.Fatal("fingerprint didn't change after the file changed")
+	}
+	if rr := get(s, strings.TrimPrefix(after, "/static"), nil); rr.Body.String() != "body { color: red; }" {
+		t.Errorf("got %q; want the new content", rr.Body.String())
+	}
+
+	// Without reload the first version is kept.
+	s, fsys = newTestServer(t, false)
+	before = s.Path("css/main.css")
+	fsys["css/main.css"] = &fstest.MapFile{Data: []byte("changed"), ModTime: time.Now()}
+	if got := s.Path("css/main.css"); got != before {
+		t.Errorf("fingerprint changed to %q without reload", got)
+	}
+}
@@ -0,0 +1,228 @@
+package assets
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// newStaticHandler mounts a Server under /static, as routes.Routes does.
+func newStaticHandler(t *testing.T) http.Handler {
+	t.Helper()
+
+	fsys := fstest.MapFS{
+		"css/main.css":       {Data: []byte("body {}")},
+		"js/main.js":         {Data: []byte("let x = 1;")},
+		"img/logo.png":       {Data: []byte("\x89PNG\r\n\x1a\n")},
+		"fonts/mono.woff2":   {Data: []byte("wOF2")},
+		"docs/index.html":    {Data: []byte("<h1>Docs</h1>")},
+		"docs/guide.txt":     {Data: []byte("0123456789")},
+		"docs/long.txt":      {Data: []byte(strings.Repeat("0123456789", 100))},
+		"data/page.unknown":  {Data: []byte("<html><script>alert(1)</script>")},
+		".env":               {Data: []byte("SECRET=1")},
+		"css/.main.css.swp":  {Data: []byte("swap")},
+		".git/config":        {Data: []byte("[core]")},
+		"img/.hidden/x.png":  {Data: []byte("x")},
+		"config/config.go":   {Data: []byte("package config")},
+		"img/favicon.ico":    {Data: []byte("ico")},
+		"img/diagram.svg":    {Data: []byte("<svg></svg>")},
+		"data/settings.json": {Data: []byte("{}")},
+	}
+
+	s, err := New(fsys, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return http.StripPrefix("/static", s)
+}
+
+// rawGet sends a request with the path exactly as given, without the
+// cleaning that httptest.NewRequest and http.Client would do.
+func rawGet(t *testing.T, h http.Handler, target string, header ...string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	raw := "GET " + target + " HTTP/1.1\r\nHost: example.com\r\n" + strings.Join(header, "\r\n")
+	if len(header) > 0 {
+		raw += "\r\n"
+	}
+	r, err := http.ReadRequest(bufio.NewReader(strings.NewReader(raw + "\r\n")))
+	if err != nil {
+		t.Fatalf("%s: %v", target, err)
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+	return rr
+}
+
+func TestPathTraversal(t *testing.T) {
+	h := newStaticHandler(t)
+
+	for _, target := range []string{
+		"/static/../config/config.go",
+		"/static/css/../../config/config.go",
+		"/static/%2e%2e/config/config.go",
+		"/static/%2E%2E%2Fconfig%2Fconfig.go",
+		"/static/..%2fconfig%2fconfig.go",
+		"/static/css/..%5c..%5cconfig%5cconfig.go",
+		`/static/css\..\..\config\config.go`,
+		"/static/./css/main.css",
+		"/static/css/./main.css",
+		"/static//css/main.css",
+		"/static/css/main.css%00.png",
+		"/static/css/main.css/",
+		"/static/%2fetc%2fpasswd",
+		"/static/....//....//config/config.go",
+	} {
+		rr := rawGet(t, h, target)
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("%s: got status %d; want 404", target, rr.Code)
+		}
+		if strings.Contains(rr.Body.String(), "package config") || strings.Contains(rr.Body.String(), "body {}") {
+			t.Errorf("%s: served a file", target)
+		}
+	}
+}
+
+func TestDotfiles(t *testing.T) {
+	h := newStaticHandler(t)
+
+	for _, target := range []string{
+		"/static/.env",
+		"/static/css/.main.css.swp",
+		"/static/.git/config",
+		"/static/.git/",
+		"/static/img/.hidden/x.png",
+		"/static/%2eenv",
+	} {
+		if rr := rawGet(t, h, target); rr.Code != http.StatusNotFound {
+			t.Errorf("%s: got status %d; want 404", target, rr.Code)
+		}
+	}
+}
+
+func TestDirectories(t *testing.T) {
+	h := newStaticHandler(t)
+
+	tests := []struct {
+		target       string
+		wantStatus   int
+		wantLocation string
+		wantBody     string
+	}{
+		{"/static/", http.StatusNotFound, "", ""},
+		{"/static/css/", http.StatusNotFound, "", ""},
+		{"/static/css", http.StatusNotFound, "", ""},
+		{"/static/img/", http.StatusNotFound, "", ""},
+		{"/static/docs/", http.StatusOK, "", "<h1>Docs</h1>"},
+		{"/static/docs", http.StatusMovedPermanently, "docs/", ""},
+	}
+
+	for _, tt := range tests {
+		rr := rawGet(t, h, tt.target)
+
+		if rr.Code != tt.wantStatus {
+			t.Errorf("%s: got status %d; want %d", tt.target, rr.Code, tt.wantStatus)
+			continue
+		}
+		if got := rr.Header().Get("Location"); got != tt.wantLocation {
+			t.Errorf("%s: got Location %q; want %q", tt.target, got, tt.wantLocation)
+		}
+		if tt.wantBody != "" && rr.Body.String() != tt.wantBody {
+			t.Errorf("%s: got body %q; want %q", tt.target, rr.Body.String(), tt.wantBody)
+		}
+		// Nothing should look like a directory listing.
+		if strings.Contains(rr.Body.String(), "<a href") {
+			t.Errorf("%s: body looks like a directory listing", tt.target)
+		}
+	}
+}
+
+func TestContentTypes(t *testing.T) {
+	h := newStaticHandler(t)
+
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/static/css/main.css", "text/css; charset=utf-8"},
+		{"/static/js/main.js", "text/javascript; charset=utf-8"},
+		{"/static/img/logo.png", "image/png"},
+		{"/static/img/diagram.svg", "image/svg+xml"},
+		{"/static/img/favicon.ico", "image/vnd.microsoft.icon"},
+		{"/static/fonts/mono.woff2", "font/woff2"},
+		{"/static/data/settings.json", "application/json"},
+		{"/static/docs/guide.txt", "text/plain; charset=utf-8"},
+		// Unknown extensions aren't sniffed, even if the content is HTML.
+		{"/static/data/page.unknown", "application/octet-stream"},
+	}
+
+	for _, tt := range tests {
+		rr := rawGet(t, h, tt.target)
+
+		if got := rr.Header().Get("Content-Type"); got != tt.want {
+			t.Errorf("%s: got Content-Type %q; want %q", tt.target, got, tt.want)
+		}
+		if got := rr.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+			t.Errorf("%s: got X-Content-Type-Options %q; want nosniff", tt.target, got)
+		}
+	}
+
+	// 404s are nosniff too.
+	if got := rawGet(t, h, "/static/missing").Header().Get("X-Content-Type-Options"); got != "nosniff" {
+		t.Errorf("404: got X-Content-Type-Options %q; want nosniff", got)
+	}
+}
+
+func TestRange(t *testing.T) {
+	h := newStaticHandler(t)
+
+	tests := []struct {
+		name       string
+		header     []string
+		wantStatus int
+		wantBody   string
+		wantRange  string
+	}{
+		{"prefix", []string{"Range: bytes=0-3"}, http.StatusPartialContent, "0123", "bytes 0-3/10"},
+		{"suffix", []string{"Range: bytes=-2"}, http.StatusPartialContent, "89", "bytes 8-9/10"},
+		{"open ended", []string{"Range: bytes=7-"}, http.StatusPartialContent, "789", "bytes 7-9/10"},
+		{"unsatisfiable", []string{"Range: bytes=20-30"}, http.StatusRequestedRangeNotSatisfiable, "", "bytes */10"},
+		{"stale If-Range", []string{"Range: bytes=0-3", `If-Range: "stale"`}, http.StatusOK, "0123456789", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := rawGet(t, h, "/static/docs/guide.txt", tt.header...)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("got status %d; want %d", rr.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && rr.Body.String() != tt.wantBody {
+				t.Errorf("got body %q; want %q", rr.Body.String(), tt.wantBody)
+			}
+			if got := rr.Header().Get("Content-Range"); got != tt.wantRange {
+				t.Errorf("got Content-Range %q; want %q", got, tt.wantRange)
+			}
+			if got := rr.Header().Get("Content-Encoding"); got != "" {
+				t.Errorf("got Content-Encoding %q; want none", got)
+			}
+		})
+	}
+
+	// Ranges refer to the file, so they aren't combined with compression.
+	rr := rawGet(t, h, "/static/docs/long.txt", "Range: bytes=10-13", "Accept-Encoding: br, gzip")
+	if rr.Code != http.StatusPartialContent || rr.Body.String() != "0123" || rr.Header().Get("Content-Encoding") != "" {
+		t.Errorf("compressible file: got status %d, body %q, Content-Encoding %q; want an uncompressed 206", rr.Code, rr.Body.String(), rr.Header().Get("Content-Encoding"))
+	}
+	if got := rawGet(t, h, "/static/docs/long.txt", "Accept-Encoding: br").Header().Get("Content-Encoding"); got != "br" {
+		t.Errorf("compressible file without a range: got Content-Encoding %q; want br", got)
+	}
+
+	if got := rawGet(t, h, "/static/docs/guide.txt").Header().Get("Accept-Ranges"); got != "bytes" {
+		t.Errorf("got Accept-Ranges %q; want bytes", got)
+	}
+}
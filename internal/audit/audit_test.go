@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Hiwiii/snippetbox.git/internal/models"
+)
+
+// memoryStore keeps events in memory, newest last.
+type memoryStore struct {
+	events []*models.AuditEvent
+}
+
+func (s *memoryStore) Insert(e *models.AuditEvent) error {
+	e.ID = int64(len(s.events) + 1)
+	s.events = append(s.events, e)
+	return nil
+}
+
+func (s *memoryStore) Each(f models.AuditFilter, fn func(*models.AuditEvent) error) error {
+	for i := len(s.events) - 1; i >= 0; i-- {
+		e := s.events[i]
+		if f.Action != "" && e.Action != f.Action {
+			continue
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestRecord(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 500, time.FixedZone("CET", 3600))
+	store := &memoryStore{}
+	a := &Auditor{Store: store, Now: func() time.Time { return now }}
+
+	err := a.Record(&models.AuditEvent{
+		Action:    models.AuditLoginFailure,
+		UserAgent: strings.Repeat("é", 300),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := store.events[0]
+	if !e.Created.Equal(now) || e.Created.Location() != time.UTC {
+		t.Errorf("got created %v; want %v in UTC", e.Created, now)
+	}
+	if n := len([]rune(e.UserAgent)); n != 255 {
+		t.Errorf("got a user agent of %d characters; want it truncated to 255", n)
+	}
+
+	var nilAuditor *Auditor
+	if err := nilAuditor.Record(&models.AuditEvent{}); err != nil {
+		t.Errorf("nil auditor returned %v", err)
+	}
+}
+
+func TestExport(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	store := &memoryStore{}
+	a := &Auditor{Store: store, Now: func() time.Time { return now }}
+
+	a.Record(&models.AuditEvent{Action: models.AuditLoginFailure, IP: "192.0.2.1", Details: "state mismatch"})
+	a.Record(&models.AuditEvent{Action: models.AuditSnippetCreate, ActorID: 7, Target: Snippet(3), UserAgent: "curl/8.0", RequestID: "abc"})
+	a.Record(&models.AuditEvent{Action: models.AuditLoginSuccess, ActorID: 7})
+
+	var buf bytes.Buffer
+	err := a.Export(&buf, models.AuditFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"id":3,"time":"2024-03-01T12:00:00Z","action":"login.success","actor_id":7}
+{"id":2,"time":"2024-03-01T12:00:00Z","action":"snippet.create","actor_id":7,"target":"snippet:3","user_agent":"curl/8.0","request_id":"abc"}
+{"id":1,"time":"2024-03-01T12:00:00Z","action":"login.failure","actor_id":null,"details":"state mismatch","ip":"192.0.2.1"}
+`
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	// The filter is passed through to the store.
+	events, err := a.Find(models.AuditFilter{Action: models.AuditLoginSuccess})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].ID != 3 {
+		t.Errorf("got %+v; want only event 3", events)
+	}
+}
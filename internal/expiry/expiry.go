@@ -0,0 +1,189 @@
+package expiry
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	// Embed the time zone database so custom dates can be entered in any zone,
+	// even on hosts without zoneinfo files.
+	_ "time/tzdata"
+)
+
+// Form values for the expiry choices which aren't presets.
+const (
+	Custom = "custom"
+	Never  = "never"
+)
+
+// NeverExpires is stored as the expiry time of snippets that never expire. It
+// is the largest value a MySQL DATETIME column can hold, so the existing
+// "expires > UTC_TIMESTAMP()" checks keep working without special cases.
+var NeverExpires = time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC)
+
+// The errors returned by Policy.Resolve.
+var (
+	ErrUnknownChoice  = errors.New("expiry: unknown choice")
+	ErrNeverForbidden = errors.New("expiry: never-expiring snippets are disabled")
+	ErrInvalidDate    = errors.New("expiry: invalid date")
+	ErrInvalidZone    = errors.New("expiry: invalid time zone")
+	ErrInPast         = errors.New("expiry: date is in the past")
+	ErrTooFar         = errors.New("expiry: date is too far in the future")
+)
+
+// customLayout is the format sent by <input type="datetime-local">.
+const customLayout = "2006-01-02T15:04"
+
+// Clock returns the current time. It is swapped for a fixed time in tests.
+type Clock func() time.Time
+
+// Preset is an expiry duration offered on the create form.
+type Preset struct {
+	Duration time.Duration
+}
+
+// Value returns the form value used for the preset.
+func (p Preset) Value() string {
+	return p.Duration.String()
+}
+
+// presetUnits are the units presets are described in, largest first.
+var presetUnits = []struct {
+	name string
+	size time.Duration
+}{
+	{"year", 365 * 24 * time.Hour},
+	{"week", 7 * 24 * time.Hour},
+	{"day", 24 * time.Hour},
+	{"hour", time.Hour},
+	{"minute", time.Minute},
+}
+
+// Unit returns the largest unit the preset is a whole number of, such as
+// "week", or "" if it isn't a whole number of minutes.
+func (p Preset) Unit() string {
+	for _, u := range presetUnits {
+		if p.Duration%u.size == 0 {
+			return u.name
+		}
+	}
+	return ""
+}
+
+// Count returns the number of Units in the preset, e.g. 2 for two weeks.
+func (p Preset) Count() int {
+	for _, u := range presetUnits {
+		if p.Duration%u.size == 0 {
+			return int(p.Duration / u.size)
+		}
+	}
+	return 0
+}
+
+// Label returns a human-readable description of the preset, such as "1 week".
+// Pages translate the Unit and Count instead.
+func (p Preset) Label() string {
+	switch n := p.Count(); {
+	case p.Unit() == "":
+		return p.Duration.String()
+	case n == 1:
+		return fmt.Sprintf("1 %s", p.Unit())
+	default:
+		return fmt.Sprintf("%d %ss", n, p.Unit())
+	}
+}
+
+// ParsePresets parses a comma-separated list of durations, such as
+// "24h,168h,8760h", into presets.
+func ParsePresets(s string) ([]Preset, error) {
+	var presets []Preset
+
+	for _, field := range strings.Split(s, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		if d < time.Minute {
+			return nil, fmt.Errorf("expiry: preset %s is shorter than a minute", d)
+		}
+		presets = append(presets, Preset{Duration: d})
+	}
+
+	return presets, nil
+}
+
+// Policy decides which expiry times are acceptable and computes them.
+type Policy struct {
+	Presets    []Preset
+	AllowNever bool
+	Now        Clock
+}
+
+// WithNever returns a copy of the policy which only allows snippets that
+// never expire if allowed is true and p allows them too.
+func (p *Policy) WithNever(allowed bool) *Policy {
+	q := *p
+	q.AllowNever = p.AllowNever && allowed
+	return &q
+}
+
+// Default returns the form value of the longest preset.
+func (p *Policy) Default() string {
+	return Preset{Duration: p.max()}.Value()
+}
+
+// Resolve turns the expiry choice from a form into an absolute expiry time.
+// The choice is either the value of a preset, Never, or Custom; for Custom the
+// date is read from the datetime-local value in date, interpreted in the IANA
+// time zone named by zone (UTC if empty). Custom dates must be in the future and
+// no further away than the longest preset.
+func (p *Policy) Resolve(choice, date, zone string) (time.Time, error) {
+	now := p.Now()
+
+	switch choice {
+	case Never:
+		if !p.AllowNever {
+			return time.Time{}, ErrNeverForbidden
+		}
+		return NeverExpires, nil
+
+	case Custom:
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return time.Time{}, ErrInvalidZone
+		}
+
+		t, err := time.ParseInLocation(customLayout, date, loc)
+		if err != nil {
+			return time.Time{}, ErrInvalidDate
+		}
+
+		if !t.After(now) {
+			return time.Time{}, ErrInPast
+		}
+		if t.Sub(now) > p.max() {
+			return time.Time{}, ErrTooFar
+		}
+		return t.UTC(), nil
+	}
+
+	for _, preset := range p.Presets {
+		if preset.Value() == choice {
+			return now.Add(preset.Duration).UTC(), nil
+		}
+	}
+
+	return time.Time{}, ErrUnknownChoice
+}
+
+// max returns the duration of the longest preset.
+func (p *Policy) max() time.Duration {
+	var max time.Duration
+	for _, preset := range p.Presets {
+		if preset.Duration > max {
+			max = preset.Duration
+		}
+	}
+	return max
+}
@@ -0,0 +1,111 @@
+package expiry
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestResolve(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	presets, err := ParsePresets("24h, 168h,8760h")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := &Policy{
+		Presets: presets,
+		Now:     func() time.Time { return now },
+	}
+
+	tests := []struct {
+		name    string
+		choice  string
+		date    string
+		zone    string
+		never   bool
+		want    time.Time
+		wantErr error
+	}{
+		{name: "Preset", choice: "168h0m0s", want: now.Add(7 * 24 * time.Hour)},
+		{name: "Unknown preset", choice: "48h0m0s", wantErr: ErrUnknownChoice},
+		{name: "Empty choice", choice: "", wantErr: ErrUnknownChoice},
+		{name: "Never allowed", choice: Never, never: true, want: NeverExpires},
+		{name: "Never forbidden", choice: Never, wantErr: ErrNeverForbidden},
+		{name: "Custom UTC", choice: Custom, date: "2024-03-05T09:30", want: time.Date(2024, 3, 5, 9, 30, 0, 0, time.UTC)},
+		{name: "Custom with zone", choice: Custom, date: "2024-03-05T09:30", zone: "Asia/Tokyo", want: time.Date(2024, 3, 5, 0, 30, 0, 0, time.UTC)},
+		{name: "Custom bad zone", choice: Custom, date: "2024-03-05T09:30", zone: "Mars/Olympus", wantErr: ErrInvalidZone},
+		{name: "Custom bad date", choice: Custom, date: "tomorrow", wantErr: ErrInvalidDate},
+		{name: "Custom in past", choice: Custom, date: "2024-03-01T11:59", wantErr: ErrInPast},
+		{name: "Custom too far", choice: Custom, date: "2025-03-02T12:00", wantErr: ErrTooFar},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy.AllowNever = tt.never
+
+			got, err := policy.Resolve(tt.choice, tt.date, tt.zone)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v; want %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("got %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithNever(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  bool
+		allowed bool
+		want    bool
+	}{
+		{name: "Both allow", policy: true, allowed: true, want: true},
+		{name: "Policy forbids", policy: false, allowed: true, want: false},
+		{name: "User not allowed", policy: true, allowed: false, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := &Policy{AllowNever: tt.policy}
+
+			got := policy.WithNever(tt.allowed)
+			if got.AllowNever != tt.want {
+				t.Errorf("got AllowNever %v; want %v", got.AllowNever, tt.want)
+			}
+			if policy.AllowNever != tt.policy {
+				t.Errorf("original policy was changed")
+			}
+		})
+	}
+}
+
+func TestPresetLabel(t *testing.T) {
+	tests := map[time.Duration]string{
+		time.Hour:                       "1 hour",
+		36 * time.Hour:                  "36 hours",
+		24 * time.Hour:                  "1 day",
+		14 * 24 * time.Hour:             "2 weeks",
+		365 * 24 * time.Hour:            "1 year",
+		90 * time.Minute:                "90 minutes",
+		90*time.Minute + 30*time.Second: "1h30m30s",
+	}
+
+	for d, want := range tests {
+		if got := (Preset{Duration: d}).Label(); got != want {
+			t.Errorf("Label(%s) = %q; want %q", d, got, want)
+		}
+	}
+}
+
+func TestParsePresets(t *testing.T) {
+	if _, err := ParsePresets("24h,soon"); err == nil {
+		t.Error("expected an error for an invalid duration")
+	}
+	if _, err := ParsePresets("30s"); err == nil {
+		t.Error("expected an error for a preset shorter than a minute")
+	}
+}
@@ -3,9 +3,96 @@ package forms
 import "github.com/Hiwiii/snippetbox.git/internal/validators"
 
 type SnippetCreateForm struct {
-	Title       string `form:"title"`
-	Content     string `form:"content"`
-	Expires     int    `form:"expires"`
-	FieldErrors map[string]string
-	Validator   validator.Validator `form:"-"`
+	Title       string            `form:"title" validate:"required,max_chars=100"`
+	Files       []SnippetFileForm `form:"files"`
+	Tags        string            `form:"tags"`
+	Expires     string            `form:"expires"`
+	ExpiresAt   string            `form:"expires_at"`
+	Timezone    string            `form:"timezone"`
+	Password    string            `form:"password" validate:"max_bytes=72"` // bcrypt ignores anything longer
+	MaxViews    int               `form:"max_views" validate:"between=0 1000"`
+	ForkedFrom  int               `form:"forked_from"`
+	NotifyEmail string            `form:"notify_email" validate:"email"`
+	Visibility  string            `form:"visibility" validate:"one_of=public unlisted private"`
+	// AllowSecrets publishes the snippet even if it looks like it contains
+	// a secret.
+	AllowSecrets bool `form:"allow_secrets"`
+
+	validator.Validator `form:"-"`
+}
+
+type SnippetFileForm struct {
+	Name     string `form:"name" validate:"max_chars=255"`
+	Language string `form:"language"`
+	Content  string `form:"content" validate:"required"`
+}
+
+type SnippetUnlockForm struct {
+	Password string `form:"password"`
+
+	validator.Validator `form:"-"`
+}
+
+type SnippetExtendForm struct {
+	Expires   string `form:"expires"`
+	ExpiresAt string `form:"expires_at"`
+	Timezone  string `form:"timezone"`
+
+	validator.Validator `form:"-"`
+}
+
+type CommentForm struct {
+	Body      string `form:"body" validate:"required,max_chars=5000"`
+	ParentID  int    `form:"parent_id"`
+	FileID    int    `form:"file_id"`
+	LineStart int    `form:"line_start"`
+	LineEnd   int    `form:"line_end"`
+
+	validator.Validator `form:"-"`
+}
+
+type ReportForm struct {
+	Reason  string `form:"reason"`
+	Details string `form:"details" validate:"max_chars=1000"`
+
+	validator.Validator `form:"-"`
+}
+
+type AuditFilterForm struct {
+	Action string `form:"action"`
+	Actor  int    `form:"actor"`
+	Target string `form:"target"`
+	From   string `form:"from"`
+	To     string `form:"to"`
+
+	validator.Validator `form:"-"`
+}
+
+type LocaleForm struct {
+	Locale string `form:"locale"`
+	Next   string `form:"next"`
+
+	validator.Validator `form:"-"`
+}
+
+type TimezoneForm struct {
+	Timezone string `form:"timezone"`
+	Next     string `form:"next"`
+
+	validator.Validator `form:"-"`
+}
+
+type TwoFactorForm struct {
+	Code string `form:"code" validate:"required"`
+
+	validator.Validator `form:"-"`
+}
+
+type ProfileForm struct {
+	Name string `form:"name" validate:"required,max_chars=255"`
+	Bio  string `form:"bio" validate:"max_chars=500"`
+	// RemoveAvatar deletes the current avatar, unless a new one is uploaded.
+	RemoveAvatar bool `form:"remove_avatar"`
+
+	validator.Validator `form:"-"`
 }
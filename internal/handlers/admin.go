@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Hiwiii/snippetbox.git/config"
+	"github.com/Hiwiii/snippetbox.git/internal/audit"
+	"github.com/Hiwiii/snippetbox.git/internal/middleware"
+	"github.com/Hiwiii/snippetbox.git/internal/models"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// AdminDashboard shows aggregate stats for the last 30 days.
+func AdminDashboard(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stats, err := app.StatsModel.Get(30, time.Now().AddDate(0, 0, -30))
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		openReports, err := app.ReportModel.CountOpen()
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		data := helpers.NewTemplateData(r)
+		data.Stats = stats
+		data.OpenReports = openReports
+
+		helpers.Render(w, r, http.StatusOK, "admin.tmpl", data)
+	}
+}
+
+// AdminSnippets lists snippets, including expired ones, optionally filtered
+// by the "q" query parameter.
+func AdminSnippets(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query().Get("q")
+
+		snippets, err := app.SnippetModel.Search(q)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		data := helpers.NewTemplateData(r)
+		data.Snippets = snippets
+		data.Query = q
+
+		helpers.Render(w, r, http.StatusOK, "admin_snippets.tmpl", data)
+	}
+}
+
+// AdminSnippetDeletePost deletes any snippet, whether or not it has expired.
+func AdminSnippetDeletePost(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loc := helpers.Localizer(r)
+
+		params := httprouter.ParamsFromContext(r.Context())
+		id, err := strconv.Atoi(params.ByName("id"))
+		if err != nil || id < 1 {
+			helpers.NotFound(w)
+			return
+		}
+
+		err = app.SnippetModel.Delete(id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				helpers.NotFound(w)
+			} else {
+				helpers.ServerError(w, err)
+			}
+			return
+		}
+
+		err = app.Moderation.Record(&models.ModerationAction{
+			ModeratorID: helpers.AuthenticatedUserID(r),
+			Action:      models.ActionDelete,
+			SnippetID:   id,
+		})
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		recordAudit(app, helpers.AuditEvent(r, models.AuditSnippetDelete, audit.Snippet(id)))
+
+		app.SessionManager.Put(r.Context(), "flash", loc.T("flash.snippet_deleted_id", id))
+
+		http.Redirect(w, r, "/admin/snippets", http.StatusSeeOther)
+	}
+}
+
+// AdminUsers lists users, optionally filtered by the "q" query parameter.
+func AdminUsers(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query().Get("q")
+
+		users, err := app.UserModel.Search(q)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		data := helpers.NewTemplateData(r)
+		data.Users = users
+		data.Query = q
+
+		helpers.Render(w, r, http.StatusOK, "admin_users.tmpl", data)
+	}
+}
+
+// AdminUserUpdatePost changes another user's role or account status. The
+// change is taken from the "action" form field: "disable", "enable",
+// "reset_2fa", which turns off two-factor authentication for users who have
+// lost their authenticator and recovery codes, or "role", which sets the
+// role in the "role" field.
+func AdminUserUpdatePost(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loc := helpers.Localizer(r)
+
+		params := httprouter.ParamsFromContext(r.Context())
+		id, err := strconv.Atoi(params.ByName("id"))
+		if err != nil || id < 1 {
+			helpers.NotFound(w)
+			return
+		}
+
+		user, err := app.UserModel.Get(id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				helpers.NotFound(w)
+			} else {
+				helpers.ServerError(w, err)
+			}
+			return
+		}
+
+		// Admins can't lock themselves out.
+		if user.ID == helpers.AuthenticatedUserID(r) {
+			helpers.ClientError(w, http.StatusForbidden)
+			return
+		}
+
+		err = r.ParseForm()
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		action := &models.ModerationAction{
+			ModeratorID:  helpers.AuthenticatedUserID(r),
+			TargetUserID: user.ID,
+		}
+
+		var flash string
+
+		switch r.PostForm.Get("action") {
+		case "disable":
+			err = app.UserModel.SetDisabled(user.ID, true)
+			action.Action = models.ActionDisable
+			flash = loc.T("flash.user_disabled", user.Name)
+		case "enable":
+			err = app.UserModel.SetDisabled(user.ID, false)
+			action.Action = models.ActionEnable
+			flash = loc.T("flash.user_enabled", user.Name)
+		case "reset_2fa":
+			err = app.TwoFactorModel.Disable(user.ID)
+			action.Action = models.ActionReset2FA
+			flash = loc.T("flash.user_2fa_reset", user.Name)
+		case "role":
+			role := models.Role(r.PostForm.Get("role"))
+			if !role.AtLeast(models.RoleUser) {
+				helpers.ClientError(w, http.StatusBadRequest)
+				return
+			}
+			err = app.UserModel.SetRole(user.ID, role)
+			action.Action = models.ActionSetRole
+			action.Note = fmt.Sprintf("%s to %s", user.Role, role)
+			flash = loc.T("flash.user_role", user.Name, loc.T("role."+string(role)))
+		default:
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		err = app.Moderation.Record(action)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		event := helpers.AuditEvent(r, models.AuditAdminAction, audit.User(user.ID))
+		event.Details = strings.TrimSpace(action.Action + " " + action.Note)
+		recordAudit(app, event)
+
+		app.SessionManager.Put(r.Context(), "flash", flash)
+
+		http.Redirect(w, r, "/admin/users?q="+url.QueryEscape(r.PostForm.Get("q")), http.StatusSeeOther)
+	}
+}
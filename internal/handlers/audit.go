@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Hiwiii/snippetbox.git/config"
+	"github.com/Hiwiii/snippetbox.git/internal/forms"
+	"github.com/Hiwiii/snippetbox.git/internal/i18n"
+	"github.com/Hiwiii/snippetbox.git/internal/middleware"
+	"github.com/Hiwiii/snippetbox.git/internal/models"
+	"github.com/Hiwiii/snippetbox.git/internal/validators"
+)
+
+// dateLayout is the format sent by <input type="date">.
+const dateLayout = "2006-01-02"
+
+// AdminAudit shows the most recent audit events matching the filter in the
+// query string.
+func AdminAudit(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var form forms.AuditFilterForm
+
+		err := helpers.DecodeQuery(r, &form)
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		filter := auditFilter(helpers.Localizer(r), &form)
+
+		data := helpers.NewTemplateData(r)
+		data.Form = form
+
+		if !form.Valid() {
+			helpers.Render(w, r, http.StatusUnprocessableEntity, "admin_audit.tmpl", data)
+			return
+		}
+
+		filter.Limit = 200
+		data.AuditEvents, err = app.Auditor.Find(filter)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		helpers.Render(w, r, http.StatusOK, "admin_audit.tmpl", data)
+	}
+}
+
+// AdminAuditExport downloads every audit event matching the filter in the
+// query string as JSON Lines, for loading into other tools. The export
+// itself is audited.
+func AdminAuditExport(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var form forms.AuditFilterForm
+
+		err := helpers.DecodeQuery(r, &form)
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		filter := auditFilter(helpers.Localizer(r), &form)
+		if !form.Valid() {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		event := helpers.AuditEvent(r, models.AuditExport, "")
+		event.Details = r.URL.RawQuery
+		recordAudit(app, event)
+
+		filename := fmt.Sprintf("audit-%s.jsonl", time.Now().UTC().Format("20060102-150405"))
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+		// The response has started by the time a database error can happen,
+		// so it can only be logged; the truncated file won't end in a newline.
+		err = app.Auditor.Export(w, filter)
+		if err != nil {
+			app.ErrorLog.Printf("exporting audit events: %v", err)
+		}
+	}
+}
+
+// auditFilter validates the filter form and converts it to a
+// models.AuditFilter. Dates are whole days in UTC, and the "to" day is
+// included.
+func auditFilter(loc *i18n.Localizer, form *forms.AuditFilterForm) models.AuditFilter {
+	filter := models.AuditFilter{
+		Action:  form.Action,
+		ActorID: form.Actor,
+		Target:  form.Target,
+	}
+
+	if form.Action != "" {
+		form.CheckField(validator.PermittedValue(form.Action, models.AuditActions...), "action", loc.T("validation.action"))
+	}
+	form.CheckField(form.Actor >= 0, "actor", loc.T("validation.user_id"))
+
+	if form.From != "" {
+		from, err := time.Parse(dateLayout, form.From)
+		form.CheckField(err == nil, "from", loc.T("validation.date"))
+		filter.Since = from
+	}
+	if form.To != "" {
+		to, err := time.Parse(dateLayout, form.To)
+		form.CheckField(err == nil, "to", loc.T("validation.date"))
+		if err == nil {
+			filter.Until = to.AddDate(0, 0, 1)
+		}
+	}
+
+	return filter
+}
+
+// recordAudit adds an event to the audit log. Handlers call it once the
+// action has been taken, so a failure is logged rather than shown to the
+// user, who would otherwise retry an action that already succeeded.
+func recordAudit(app *config.Application, event *models.AuditEvent) {
+	err := app.Auditor.Record(event)
+	if err != nil {
+		app.ErrorLog.Printf("recording audit event %s %s: %v", event.Action, event.Target, err)
+	}
+}
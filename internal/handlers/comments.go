@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Hiwiii/snippetbox.git/config"
+	"github.com/Hiwiii/snippetbox.git/internal/forms"
+	"github.com/Hiwiii/snippetbox.git/internal/middleware"
+	"github.com/Hiwiii/snippetbox.git/internal/models"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// CommentCreatePost adds a comment, or a reply to a comment, to a snippet. The
+// route requires a logged in user, who becomes the author.
+func CommentCreatePost(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loc := helpers.Localizer(r)
+
+		params := httprouter.ParamsFromContext(r.Context())
+		id, err := strconv.Atoi(params.ByName("id"))
+		if err != nil || id < 1 {
+			helpers.NotFound(w)
+			return
+		}
+
+		snippet, err := app.SnippetModel.Get(id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				helpers.NotFound(w)
+			} else {
+				helpers.ServerError(w, err)
+			}
+			return
+		}
+
+		// Private snippets don't exist for anyone but their author.
+		if !helpers.SnippetVisible(r, snippet) {
+			helpers.NotFound(w)
+			return
+		}
+
+		// Only people who can see the snippet can comment on it, and
+		// view-limited snippets don't take comments at all.
+		if !helpers.SnippetUnlocked(r, snippet) || snippet.ViewLimited() {
+			http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+			return
+		}
+
+		var form forms.CommentForm
+
+		err = helpers.DecodePostForm(r, &form)
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		form.CheckStruct(&form, validationMessage(loc))
+
+		// Replies must belong to a visible comment on the same snippet, and
+		// share the anchor of the comment they reply to.
+		if form.ParentID > 0 {
+			parent, err := app.CommentModel.Get(form.ParentID)
+			if err != nil && !errors.Is(err, models.ErrNoRecord) {
+				helpers.ServerError(w, err)
+				return
+			}
+			form.Check(err == nil && parent.SnippetID == snippet.ID && !parent.Hidden, loc.T("validation.reply_gone"))
+			form.FileID = 0
+		}
+
+		// Anchored comments must refer to existing lines in one of the snippet's files.
+		if form.FileID > 0 {
+			lines := 0
+			for _, f := range snippet.Files {
+				if f.ID == form.FileID {
+					lines = strings.Count(strings.ReplaceAll(f.Content, "\r\n", "\n"), "\n") + 1
+				}
+			}
+			if form.LineEnd == 0 {
+				form.LineEnd = form.LineStart
+			}
+
+			form.CheckField(lines > 0, "lines", loc.T("validation.file_missing"))
+			form.CheckField(form.LineStart >= 1 && form.LineStart <= form.LineEnd && form.LineEnd <= lines, "lines", loc.T("validation.lines", lines))
+		}
+
+		if !form.Valid() {
+			renderSnippet(w, r, app, helpers, snippet, http.StatusUnprocessableEntity, form)
+			return
+		}
+
+		commentID, err := app.CommentModel.Insert(&models.Comment{
+			SnippetID: snippet.ID,
+			ParentID:  form.ParentID,
+			FileID:    form.FileID,
+			LineStart: form.LineStart,
+			LineEnd:   form.LineEnd,
+			UserID:    helpers.AuthenticatedUserID(r),
+			Body:      form.Body,
+		})
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		app.SessionManager.Put(r.Context(), "flash", loc.T("flash.comment_added"))
+
+		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d#comment-%d", snippet.ID, commentID), http.StatusSeeOther)
+	}
+}
+
+// CommentModeratePost lets the owner of a snippet hide, unhide or delete a
+// comment on it. The action is taken from the "action" form field.
+func CommentModeratePost(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loc := helpers.Localizer(r)
+
+		params := httprouter.ParamsFromContext(r.Context())
+		id, err := strconv.Atoi(params.ByName("id"))
+		if err != nil || id < 1 {
+			helpers.NotFound(w)
+			return
+		}
+
+		comment, err := app.CommentModel.Get(id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				helpers.NotFound(w)
+			} else {
+				helpers.ServerError(w, err)
+			}
+			return
+		}
+
+		snippet, err := app.SnippetModel.Get(comment.SnippetID)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				helpers.NotFound(w)
+			} else {
+				helpers.ServerError(w, err)
+			}
+			return
+		}
+
+		// Only the owner of the snippet may moderate its comments.
+		if !helpers.OwnsSnippet(r, snippet) {
+			helpers.ClientError(w, http.StatusForbidden)
+			return
+		}
+
+		err = r.ParseForm()
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		var flash string
+
+		switch r.PostForm.Get("action") {
+		case "hide":
+			err = app.CommentModel.SetHidden(comment.ID, comment.SnippetID, true)
+			flash = loc.T("flash.comment_hidden")
+		case "unhide":
+			err = app.CommentModel.SetHidden(comment.ID, comment.SnippetID, false)
+			flash = loc.T("flash.comment_unhidden")
+		case "delete":
+			err = app.CommentModel.Delete(comment.ID, comment.SnippetID)
+			flash = loc.T("flash.comment_deleted")
+		default:
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				helpers.NotFound(w)
+			} else {
+				helpers.ServerError(w, err)
+			}
+			return
+		}
+
+		app.SessionManager.Put(r.Context(), "flash", flash)
+
+		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", comment.SnippetID), http.StatusSeeOther)
+	}
+}
@@ -1,25 +1,71 @@
 package handlers
 
 import (
+	"archive/zip"
+	"bytes"
 	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/Hiwiii/snippetbox.git/config"
+	"github.com/Hiwiii/snippetbox.git/internal/audit"
+	"github.com/Hiwiii/snippetbox.git/internal/expiry"
 	"github.com/Hiwiii/snippetbox.git/internal/forms"
+	"github.com/Hiwiii/snippetbox.git/internal/i18n"
 	"github.com/Hiwiii/snippetbox.git/internal/middleware"
 	"github.com/Hiwiii/snippetbox.git/internal/models"
+	"github.com/Hiwiii/snippetbox.git/internal/secrets"
+	"github.com/Hiwiii/snippetbox.git/internal/templates"
 	"github.com/Hiwiii/snippetbox.git/internal/validators"
 
 	"github.com/julienschmidt/httprouter"
-	// "github.com/Hiwiii/snippetbox.git/internal/templates"
 )
 
 // Home handler with dependency injection using middleware.Helpers
 func Home(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		snippets, err := app.SnippetModel.Latest()
+		snippets, err := app.SnippetModel.Latest("")
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		tags, err := app.TagModel.Popular(30)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		mostStarred, err := app.StarModel.MostStarred(time.Now().AddDate(0, 0, -7), 5)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		data := helpers.NewTemplateData(r)
+		data.Snippets = snippets
+		data.Tags = tags
+		data.MostStarred = mostStarred
+
+		helpers.Render(w, r, http.StatusOK, "home.tmpl", data)
+	}
+}
+
+// TagView handler lists the latest snippets with a given tag.
+func TagView(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+		tag := params.ByName("tag")
+		if !validator.Matches(tag, validator.TagRX) {
+			helpers.NotFound(w)
+			return
+		}
+
+		snippets, err := app.SnippetModel.Latest(tag)
 		if err != nil {
 			helpers.ServerError(w, err)
 			return
@@ -27,8 +73,51 @@ func Home(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc
 
 		data := helpers.NewTemplateData(r)
 		data.Snippets = snippets
+		data.Tag = tag
+
+		helpers.Render(w, r, http.StatusOK, "tag.tmpl", data)
+	}
+}
+
+// MySnippets handler lists the logged in user's snippets a page at a time,
+// including unlisted and private ones, or else the snippets created in the
+// current session. Password-protected and view-limited snippets are listed
+// too.
+func MySnippets(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := helpers.NewTemplateData(r)
+
+		if userID := helpers.AuthenticatedUserID(r); userID > 0 {
+			page, ok := pageNumber(r)
+			if !ok {
+				helpers.NotFound(w)
+				return
+			}
 
-		helpers.Render(w, http.StatusOK, "home.tmpl", data)
+			snippets, err := app.SnippetModel.ByUser(userID, true, pageSize+1, (page-1)*pageSize)
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+			paginate(data, page, snippets)
+		} else {
+			snippets, err := app.SnippetModel.GetMany(helpers.OwnedSnippetIDs(r))
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+
+			// Snippets created while logged in belong to the account, even
+			// if this session used to own them.
+			data.Snippets = []*models.Snippet{}
+			for _, s := range snippets {
+				if helpers.OwnsSnippet(r, s) {
+					data.Snippets = append(data.Snippets, s)
+				}
+			}
+		}
+
+		helpers.Render(w, r, http.StatusOK, "mine.tmpl", data)
 	}
 }
 
@@ -38,19 +127,24 @@ func SnippetCreate(app *config.Application, helpers *middleware.Helpers) http.Ha
 		// Initialize template data
 		data := helpers.NewTemplateData(r)
 
-		// Set the default snippet expiry to 365 days.
+		// Default to the longest expiry preset.
 		data.Form = forms.SnippetCreateForm{
-			Expires: 365,
+			Files:      []forms.SnippetFileForm{{Language: "text"}},
+			Expires:    app.ExpiryPolicy.Default(),
+			Visibility: string(models.VisibilityPublic),
 		}
+		data.ExpiryPolicy = expiryPolicy(r, app, helpers)
 
 		// Render the form template
-		helpers.Render(w, http.StatusOK, "create.tmpl", data)
+		helpers.Render(w, r, http.StatusOK, "create.tmpl", data)
 	}
 }
 
 // SnippetCreatePost handler with dependency injection using middleware.Helpers
 func SnippetCreatePost(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		loc := helpers.Localizer(r)
+
 		// Declare a new empty instance of the SnippetCreateForm struct.
 		var form forms.SnippetCreateForm
 
@@ -61,29 +155,107 @@ func SnippetCreatePost(app *config.Application, helpers *middleware.Helpers) htt
 			return
 		}
 
-		// Validate the form fields using the validator.
-		form.Validator.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
-		form.Validator.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
-		form.Validator.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
-		form.Validator.CheckField(validator.PermittedInt(form.Expires, 1, 7, 365), "expires", "This field must equal 1, 7, or 365")
+		// Drop file entries which were left completely empty, for example by
+		// removing a file in the browser, and give unnamed files a default name.
+		files := []forms.SnippetFileForm{}
+		for _, f := range form.Files {
+			if !validator.NotBlank(f.Name) && !validator.NotBlank(f.Content) {
+				continue
+			}
+			if !validator.NotBlank(f.Name) {
+				f.Name = fmt.Sprintf("file%d.txt", len(files)+1)
+			}
+			files = append(files, f)
+		}
+		form.Files = files
+
+		// Check the rules in the form's validate tags, then the ones which
+		// need more than a single field.
+		form.CheckStruct(&form, validationMessage(loc))
+
+		form.CheckField(len(form.Files) > 0, "files", loc.T("validation.files_min"))
+		form.CheckField(len(form.Files) <= 20, "files", loc.T("validation.files_max", 20))
+		form.CheckField(validator.Unique(form.Files, func(f forms.SnippetFileForm) string { return f.Name }), "files", loc.T("validation.file_names"))
+
+		for i, f := range form.Files {
+			// File names become entries in the zip download, so keep them flat.
+			form.CheckField(!strings.ContainsAny(f.Name, `/\`) && f.Name != "." && f.Name != "..", fmt.Sprintf("files[%d].name", i), loc.T("validation.no_slashes"))
+
+			form.CheckField(validator.PermittedValue(f.Language, models.Languages...), fmt.Sprintf("files[%d].language", i), loc.T("validation.language"))
+		}
+
+		tags := parseTags(form.Tags)
+		form.CheckField(len(tags) <= 10, "tags", loc.T("validation.tags_max", 10))
+		for _, tag := range tags {
+			form.CheckField(validator.MaxChars(tag, 30), "tags", loc.T("validation.tag_max_chars", 30))
+			form.CheckField(validator.Matches(tag, validator.TagRX), "tags", loc.T("validation.tag_chars"))
+		}
+
+		// Work out the expiry time from the chosen preset or custom date.
+		expires, err := expiryPolicy(r, app, helpers).Resolve(form.Expires, form.ExpiresAt, form.Timezone)
+		if err != nil {
+			form.AddFieldError("expires", expiryErrorMessage(loc, err))
+		}
+
+		// Only the author can see a private snippet, so it needs an account.
+		if form.Visibility == "" {
+			form.Visibility = string(models.VisibilityPublic)
+		}
+		form.CheckField(form.Visibility != string(models.VisibilityPrivate) || helpers.IsAuthenticated(r), "visibility", loc.T("validation.private_login"))
+
+		// The parent of a fork may expire or be deleted while the form is being
+		// filled in; the fork keeps the reference either way.
+		form.CheckField(form.ForkedFrom >= 0, "forked_from", loc.T("validation.snippet_id"))
+
+		// Warn about credentials pasted by mistake, unless the user has
+		// already confirmed they want to publish them.
+		if !form.AllowSecrets {
+			checkSecrets(loc, &form.Validator, app.Secrets, form.Files)
+		}
 
 		// If validation fails, re-display the form with validation errors.
-		if !form.Validator.Valid() {
+		if !form.Valid() {
 			data := helpers.NewTemplateData(r)
 			data.Form = form
-			helpers.Render(w, http.StatusUnprocessableEntity, "create.tmpl", data)
+			data.ExpiryPolicy = expiryPolicy(r, app, helpers)
+			helpers.Render(w, r, http.StatusUnprocessableEntity, "create.tmpl", data)
 			return
 		}
 
 		// Pass the validated form data to the SnippetModel.Insert() method.
-		id, err := app.SnippetModel.Insert(form.Title, form.Content, form.Expires)
+		snippet := &models.Snippet{
+			Title:       form.Title,
+			Tags:        tags,
+			Expires:     expires,
+			ForkedFrom:  form.ForkedFrom,
+			NotifyEmail: form.NotifyEmail,
+			UserID:      helpers.AuthenticatedUserID(r),
+			Visibility:  models.Visibility(form.Visibility),
+		}
+		for _, f := range form.Files {
+			snippet.Files = append(snippet.Files, &models.SnippetFile{Name: f.Name, Language: f.Language, Content: f.Content})
+		}
+
+		id, err := app.SnippetModel.Insert(snippet, form.Password, form.MaxViews)
 		if err != nil {
 			helpers.ServerError(w, err)
 			return
 		}
 
+		event := helpers.AuditEvent(r, models.AuditSnippetCreate, audit.Snippet(id))
+		if form.AllowSecrets {
+			event.Details = "published despite a secret warning"
+		}
+		recordAudit(app, event)
+
+		// Remember that this session created the snippet so it can manage it
+		// later. Snippets created while logged in belong to the account.
+		if snippet.UserID == 0 {
+			helpers.OwnSnippet(r, id)
+		}
+
 		// Use the SessionManager to add a flash message to the session.
-		app.SessionManager.Put(r.Context(), "flash", "Snippet successfully created!")
+		app.SessionManager.Put(r.Context(), "flash", loc.T("flash.snippet_created"))
 
 		// Redirect the user to the relevant page for the snippet.
 		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
@@ -92,6 +264,62 @@ func SnippetCreatePost(app *config.Application, helpers *middleware.Helpers) htt
 
 // SnippetView handler with dependency injection using middleware.Helpers
 func SnippetView(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+		id, err := strconv.Atoi(params.ByName("id"))
+		if err != nil || id < 1 {
+			helpers.NotFound(w)
+			return
+		}
+
+		// Moderators can still see snippets that have been hidden.
+		var snippet *models.Snippet
+		if user := helpers.AuthenticatedUser(r); user != nil && user.IsModerator() {
+			snippet, err = app.SnippetModel.GetIncludingHidden(id)
+		} else {
+			snippet, err = app.SnippetModel.Get(id)
+		}
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				helpers.NotFound(w)
+			} else {
+				helpers.ServerError(w, err)
+			}
+			return
+		}
+
+		// Private snippets don't exist for anyone but their author.
+		if !helpers.SnippetVisible(r, snippet) {
+			helpers.NotFound(w)
+			return
+		}
+
+		// Ask for the password instead of showing a protected snippet that
+		// hasn't been unlocked in this session.
+		if !helpers.SnippetUnlocked(r, snippet) {
+			data := helpers.NewTemplateData(r)
+			data.Snippet = &models.Snippet{ID: snippet.ID}
+			data.Form = forms.SnippetUnlockForm{}
+			helpers.Render(w, r, http.StatusOK, "unlock.tmpl", data)
+			return
+		}
+
+		// Viewing a view-limited snippet uses up a view, so only reveal it
+		// after an explicit POST. Link previewers and crawlers only send GET
+		// requests and can't burn the snippet this way.
+		if snippet.ViewLimited() {
+			data := helpers.NewTemplateData(r)
+			data.Snippet = &models.Snippet{ID: snippet.ID, RemainingViews: snippet.RemainingViews}
+			helpers.Render(w, r, http.StatusOK, "reveal.tmpl", data)
+			return
+		}
+
+		renderSnippet(w, r, app, helpers, snippet, http.StatusOK, forms.CommentForm{})
+	}
+}
+
+// SnippetFork shows the create form pre-filled with a copy of an existing snippet.
+func SnippetFork(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		params := httprouter.ParamsFromContext(r.Context())
 		id, err := strconv.Atoi(params.ByName("id"))
@@ -110,9 +338,495 @@ func SnippetView(app *config.Application, helpers *middleware.Helpers) http.Hand
 			return
 		}
 
+		// Private snippets don't exist for anyone but their author.
+		if !helpers.SnippetVisible(r, snippet) {
+			helpers.NotFound(w)
+			return
+		}
+
+		// Forking reveals the content, so it is subject to the same rules as
+		// the download: the snippet must be unlocked and not view-limited.
+		if !helpers.SnippetUnlocked(r, snippet) || snippet.ViewLimited() {
+			http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+			return
+		}
+
+		form := forms.SnippetCreateForm{
+			Title:      snippet.Title,
+			Tags:       strings.Join(snippet.Tags, " "),
+			Expires:    app.ExpiryPolicy.Default(),
+			ForkedFrom: snippet.ID,
+			Visibility: string(models.VisibilityPublic),
+		}
+		for _, f := range snippet.Files {
+			form.Files = append(form.Files, forms.SnippetFileForm{Name: f.Name, Language: f.Language, Content: f.Content})
+		}
+
 		data := helpers.NewTemplateData(r)
-		data.Snippet = snippet
+		data.Form = form
+		data.ExpiryPolicy = expiryPolicy(r, app, helpers)
+
+		helpers.Render(w, r, http.StatusOK, "create.tmpl", data)
+	}
+}
+
+// SnippetDownload sends all the files of a snippet as a zip archive.
+func SnippetDownload(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+		id, err := strconv.Atoi(params.ByName("id"))
+		if err != nil || id < 1 {
+			helpers.NotFound(w)
+			return
+		}
+
+		snippet, err := app.SnippetModel.Get(id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				helpers.NotFound(w)
+			} else {
+				helpers.ServerError(w, err)
+			}
+			return
+		}
+
+		// Private snippets don't exist for anyone but their author.
+		if !helpers.SnippetVisible(r, snippet) {
+			helpers.NotFound(w)
+			return
+		}
+
+		// Apply the same protection as the view page. View-limited snippets
+		// can't be downloaded at all, because a GET must never use up a view.
+		if !helpers.SnippetUnlocked(r, snippet) || snippet.ViewLimited() {
+			http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+			return
+		}
+
+		// Build the archive in memory so that errors can still be reported
+		// with a proper status code.
+		buf := new(bytes.Buffer)
+		zw := zip.NewWriter(buf)
+
+		for _, f := range snippet.Files {
+			fw, err := zw.Create(f.Name)
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+
+			_, err = fw.Write([]byte(f.Content))
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+		}
+
+		err = zw.Close()
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="snippet-%d.zip"`, snippet.ID))
+
+		_, err = buf.WriteTo(w)
+		if err != nil {
+			helpers.ServerError(w, err)
+		}
+	}
+}
+
+// SnippetRevealPost uses up one view of a view-limited snippet and displays it.
+func SnippetRevealPost(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+		id, err := strconv.Atoi(params.ByName("id"))
+		if err != nil || id < 1 {
+			helpers.NotFound(w)
+			return
+		}
+
+		snippet, err := app.SnippetModel.Get(id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				helpers.NotFound(w)
+			} else {
+				helpers.ServerError(w, err)
+			}
+			return
+		}
+
+		// Private snippets don't exist for anyone but their author.
+		if !helpers.SnippetVisible(r, snippet) {
+			helpers.NotFound(w)
+			return
+		}
+
+		// Send the user back to the view page if the snippet still needs to be
+		// unlocked, or if it isn't view-limited and there's nothing to reveal.
+		if !helpers.SnippetUnlocked(r, snippet) || !snippet.ViewLimited() {
+			http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+			return
+		}
+
+		// Another viewer may have taken the last view since the Get() above,
+		// in which case Consume() reports that the snippet no longer exists.
+		snippet, err = app.SnippetModel.Consume(id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				helpers.NotFound(w)
+			} else {
+				helpers.ServerError(w, err)
+			}
+			return
+		}
+
+		// Consume() deletes the snippet along with its last view, which the
+		// audit log records like any other delete.
+		if snippet.RemainingViews.Int32 <= 0 {
+			event := helpers.AuditEvent(r, models.AuditSnippetDelete, audit.Snippet(id))
+			event.Details = "burned after reading"
+			recordAudit(app, event)
+		}
+
+		renderSnippet(w, r, app, helpers, snippet, http.StatusOK, forms.CommentForm{})
+	}
+}
+
+// SnippetUnlockPost checks the password for a protected snippet and, if it
+// matches, records the unlock in the session.
+func SnippetUnlockPost(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loc := helpers.Localizer(r)
+
+		params := httprouter.ParamsFromContext(r.Context())
+		id, err := strconv.Atoi(params.ByName("id"))
+		if err != nil || id < 1 {
+			helpers.NotFound(w)
+			return
+		}
+
+		// Count every guess before checking it, and refuse further guesses
+		// once this client has used up its allowance for the snippet.
+		limiterKey := fmt.Sprintf("%s:%d", helpers.ClientIP(r), id)
+		if !app.UnlockLimiter.Allow(limiterKey) {
+			helpers.ClientError(w, http.StatusTooManyRequests)
+			return
+		}
+
+		var form forms.SnippetUnlockForm
+
+		err = helpers.DecodePostForm(r, &form)
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		snippet, err := app.SnippetModel.Get(id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				helpers.NotFound(w)
+			} else {
+				helpers.ServerError(w, err)
+			}
+			return
+		}
+
+		// Private snippets don't exist for anyone but their author.
+		if !helpers.SnippetVisible(r, snippet) {
+			helpers.NotFound(w)
+			return
+		}
+
+		matches, err := snippet.PasswordMatches(form.Password)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		if !matches {
+			form.AddFieldError("password", loc.T("validation.password"))
+
+			data := helpers.NewTemplateData(r)
+			data.Snippet = &models.Snippet{ID: snippet.ID}
+			data.Form = form
+			helpers.Render(w, r, http.StatusUnprocessableEntity, "unlock.tmpl", data)
+			return
+		}
+
+		app.UnlockLimiter.Reset(limiterKey)
+		helpers.UnlockSnippet(r, snippet.ID)
+
+		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+	}
+}
+
+// SnippetManage handles the link in an expiry reminder email. For snippets
+// created without logging in, a valid token makes the current session an
+// owner of the snippet, so the extend form is shown on the view page. The
+// authors of other snippets are asked to log in instead.
+func SnippetManage(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loc := helpers.Localizer(r)
+
+		params := httprouter.ParamsFromContext(r.Context())
+		id, err := strconv.Atoi(params.ByName("id"))
+		if err != nil || id < 1 {
+			helpers.NotFound(w)
+			return
+		}
+
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			helpers.NotFound(w)
+			return
+		}
+
+		ok, err := app.SnippetModel.ManageTokenMatches(id, token)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		if !ok {
+			helpers.NotFound(w)
+			return
+		}
+
+		snippet, err := app.SnippetModel.Get(id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				helpers.NotFound(w)
+			} else {
+				helpers.ServerError(w, err)
+			}
+			return
+		}
+
+		if snippet.UserID == 0 {
+			helpers.OwnSnippet(r, id)
+		}
+		if !helpers.OwnsSnippet(r, snippet) {
+			app.SessionManager.Put(r.Context(), "flash", loc.T("flash.login_to_extend"))
+			http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+			return
+		}
+
+		app.SessionManager.Put(r.Context(), "flash", loc.T("flash.extend_below"))
 
-		helpers.Render(w, http.StatusOK, "view.tmpl", data)
+		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d#extend", id), http.StatusSeeOther)
 	}
 }
+
+// SnippetExtendPost lets the owner of a snippet move its expiry time further
+// into the future.
+func SnippetExtendPost(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loc := helpers.Localizer(r)
+
+		params := httprouter.ParamsFromContext(r.Context())
+		id, err := strconv.Atoi(params.ByName("id"))
+		if err != nil || id < 1 {
+			helpers.NotFound(w)
+			return
+		}
+
+		snippet, err := app.SnippetModel.Get(id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				helpers.NotFound(w)
+			} else {
+				helpers.ServerError(w, err)
+			}
+			return
+		}
+
+		// Only the owner of the snippet may extend it.
+		if !helpers.OwnsSnippet(r, snippet) {
+			helpers.ClientError(w, http.StatusForbidden)
+			return
+		}
+
+		var form forms.SnippetExtendForm
+
+		err = helpers.DecodePostForm(r, &form)
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		expires, err := expiryPolicy(r, app, helpers).Resolve(form.Expires, form.ExpiresAt, form.Timezone)
+		if err != nil {
+			form.AddFieldError("expires", expiryErrorMessage(loc, err))
+		} else {
+			form.CheckField(expires.After(snippet.Expires), "expires", loc.T("validation.expiry_later"))
+		}
+
+		// The extend form lives on the view page, so report problems with a
+		// flash message rather than re-rendering a separate form.
+		if !form.Valid() {
+			app.SessionManager.Put(r.Context(), "flash", loc.T("flash.expiry_not_changed", form.FieldError("expires")))
+			http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+			return
+		}
+
+		err = app.SnippetModel.Extend(id, expires)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				helpers.NotFound(w)
+			} else {
+				helpers.ServerError(w, err)
+			}
+			return
+		}
+
+		event := helpers.AuditEvent(r, models.AuditSnippetEdit, audit.Snippet(id))
+		event.Details = "expiry extended to " + expires.UTC().Format(time.RFC3339)
+		recordAudit(app, event)
+
+		app.SessionManager.Put(r.Context(), "flash", loc.T("flash.expiry_extended"))
+
+		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+	}
+}
+
+// validationMessage returns the messages for rules in validate tags, which
+// the catalogs hold as "validation.<rule>".
+func validationMessage(loc *i18n.Localizer) validator.MessageFunc {
+	return func(rule string, params ...any) string {
+		return loc.T("validation."+rule, params...)
+	}
+}
+
+// expiryPolicy returns the expiry policy for the current user. Only admins
+// may make snippets that never expire, and only if the site allows them.
+func expiryPolicy(r *http.Request, app *config.Application, helpers *middleware.Helpers) *expiry.Policy {
+	user := helpers.AuthenticatedUser(r)
+	return app.ExpiryPolicy.WithNever(user != nil && user.IsAdmin())
+}
+
+// expiryErrorMessage converts an error from expiry.Policy.Resolve into a
+// message suitable for displaying next to the expiry field.
+func expiryErrorMessage(loc *i18n.Localizer, err error) string {
+	switch {
+	case errors.Is(err, expiry.ErrNeverForbidden):
+		return loc.T("validation.expiry.never")
+	case errors.Is(err, expiry.ErrInvalidDate):
+		return loc.T("validation.expiry.date")
+	case errors.Is(err, expiry.ErrInvalidZone):
+		return loc.T("validation.expiry.zone")
+	case errors.Is(err, expiry.ErrInPast):
+		return loc.T("validation.expiry.past")
+	case errors.Is(err, expiry.ErrTooFar):
+		return loc.T("validation.expiry.too_far")
+	default:
+		return loc.T("validation.expiry.choice")
+	}
+}
+
+// checkSecrets adds a "secrets" field error if any of the files look like they
+// contain a secret. At most three findings are listed in the message.
+func checkSecrets(loc *i18n.Localizer, v *validator.Validator, d *secrets.Detector, files []forms.SnippetFileForm) {
+	var found []string
+
+	for _, f := range files {
+		for _, finding := range d.Scan(f.Content) {
+			found = append(found, loc.T("secrets.finding", loc.T("secrets.rule."+finding.Rule), f.Name, finding.Line))
+		}
+	}
+
+	if len(found) == 0 {
+		return
+	}
+	if len(found) > 3 {
+		found = append(found[:3], loc.T("secrets.more", len(found)-3))
+	}
+
+	v.AddFieldError("secrets", loc.T("validation.secrets", strings.Join(found, ", ")))
+}
+
+// parseTags splits a comma or space separated list of tags, lowercasing them
+// and dropping duplicates.
+func parseTags(s string) []string {
+	tags := []string{}
+	seen := make(map[string]bool)
+
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	for _, tag := range fields {
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+// renderSnippet renders the view page for a snippet which the user is allowed
+// to see, along with its lineage, forks and comments. The comment form is
+// re-displayed with any validation errors it holds.
+func renderSnippet(w http.ResponseWriter, r *http.Request, app *config.Application, helpers *middleware.Helpers, snippet *models.Snippet, status int, commentForm forms.CommentForm) {
+	// The contents of protected and view-limited snippets are secret, so they
+	// mustn't be cached, nor compressed along with what the visitor typed in.
+	if snippet.Protected() || snippet.ViewLimited() {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+
+	data := helpers.NewTemplateData(r)
+	data.Snippet = snippet
+	data.OwnsSnippet = helpers.OwnsSnippet(r, snippet)
+	data.ExpiryPolicy = expiryPolicy(r, app, helpers)
+	data.Form = forms.SnippetExtendForm{Expires: app.ExpiryPolicy.Default()}
+	data.CommentForm = commentForm
+
+	// The owner moderates the comments, so they also see the hidden ones.
+	comments, err := app.CommentModel.ForSnippet(snippet.ID, data.OwnsSnippet)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	data.Files, data.Comments = templates.Annotate(snippet.Files, comments, data.OwnsSnippet, data.IsAuthenticated)
+
+	// Link to the author's profile, unless their account has been disabled.
+	if snippet.UserID > 0 {
+		author, err := app.UserModel.Get(snippet.UserID)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			helpers.ServerError(w, err)
+			return
+		}
+		if author != nil && !author.Disabled {
+			data.Author = author
+		}
+	}
+
+	if userID := helpers.AuthenticatedUserID(r); userID > 0 {
+		data.Starred, err = app.StarModel.Exists(userID, snippet.ID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	// A fork still shows its parent's ID after the parent has expired or been
+	// deleted, but only links to it while it is available.
+	if snippet.ForkedFrom > 0 {
+		available, err := app.SnippetModel.Exists(snippet.ForkedFrom)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		data.ParentAvailable = available
+	}
+
+	forks, err := app.SnippetModel.Forks(snippet.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	data.Forks = forks
+
+	helpers.Render(w, r, status, "view.tmpl", data)
+}
@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"html"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Hiwiii/snippetbox.git/config"
+	"github.com/Hiwiii/snippetbox.git/internal/expiry"
+	"github.com/Hiwiii/snippetbox.git/internal/i18n"
+	"github.com/Hiwiii/snippetbox.git/internal/middleware"
+	"github.com/Hiwiii/snippetbox.git/internal/models"
+	"github.com/Hiwiii/snippetbox.git/internal/secrets"
+	"github.com/Hiwiii/snippetbox.git/internal/templates"
+	"github.com/Hiwiii/snippetbox.git/ui"
+	"github.com/alexedwards/scs/v2"
+	"github.com/go-playground/form/v4"
+	"github.com/julienschmidt/httprouter"
+	"github.com/justinas/alice"
+)
+
+// fakeSnippets keeps snippets in memory. Methods the tests don't use are left
+// to the embedded nil interface, so calling one of them panics.
+type fakeSnippets struct {
+	config.SnippetStore
+	snippets map[int]*models.Snippet
+}
+
+func (s *fakeSnippets) Get(id int) (*models.Snippet, error) {
+	snippet, ok := s.snippets[id]
+	if !ok {
+		return nil, models.ErrNoRecord
+	}
+	return snippet, nil
+}
+
+func (s *fakeSnippets) Forks(id int) ([]*models.Snippet, error) {
+	return nil, nil
+}
+
+type fakeComments struct {
+	config.CommentStore
+}
+
+func (c *fakeComments) ForSnippet(snippetID int, includeHidden bool) ([]*models.Comment, error) {
+	return nil, nil
+}
+
+type fakeUsers struct {
+	config.UserStore
+	users map[int]*models.User
+}
+
+func (u *fakeUsers) Get(id int) (*models.User, error) {
+	user, ok := u.users[id]
+	if !ok {
+		return nil, models.ErrNoRecord
+	}
+	return user, nil
+}
+
+type fakeStars struct {
+	config.StarStore
+}
+
+func (s *fakeStars) Exists(userID, snippetID int) (bool, error) {
+	return false, nil
+}
+
+// testServer serves the handlers under test with the session, authentication
+// and locale middleware of the real routes. Visiting /test/login logs the
+// client in as user 1.
+func testServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	locales, err := fs.Sub(ui.Files, "locales")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := i18n.Load(locales, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache, err := templates.NewLocaleCache(ui.Files, nil, bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	presets, err := expiry.ParsePresets("24h,168h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	detector, err := secrets.ParseRules(secrets.DefaultRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &config.Application{
+		InfoLog:  log.New(io.Discard, "", 0),
+		ErrorLog: log.New(io.Discard, "", 0),
+		SnippetModel: &fakeSnippets{snippets: map[int]*models.Snippet{
+			1: {
+				ID:         1,
+				Title:      "An old silent pond",
+				Files:      []*models.SnippetFile{{ID: 1, Name: "pond.txt", Content: "An old silent pond...\nA frog jumps into the pond,"}},
+				Created:    time.Now(),
+				Expires:    time.Now().Add(24 * time.Hour),
+				Visibility: models.VisibilityPublic,
+			},
+		}},
+		CommentModel:   &fakeComments{},
+		UserModel:      &fakeUsers{users: map[int]*models.User{1: {ID: 1, Name: "Alice", Username: "alice", Role: models.RoleUser}}},
+		StarModel:      &fakeStars{},
+		TemplateCache:  cache,
+		FormDecoder:    form.NewDecoder(),
+		SessionManager: scs.New(),
+		ExpiryPolicy:   &expiry.Policy{Presets: presets, Now: time.Now},
+		Secrets:        detector,
+	}
+	helpers := &middleware.Helpers{
+		ErrorLog:       app.ErrorLog,
+		TemplateCache:  cache,
+		FormDecoder:    app.FormDecoder,
+		SessionManager: app.SessionManager,
+		I18n:           bundle,
+	}
+
+	dynamic := alice.New(app.SessionManager.LoadAndSave, middleware.Authenticate(app, helpers), middleware.Localize(helpers))
+
+	router := httprouter.New()
+	router.Handler(http.MethodGet, "/snippet/view/:id", dynamic.ThenFunc(SnippetView(app, helpers)))
+	router.Handler(http.MethodPost, "/snippet/create", dynamic.ThenFunc(SnippetCreatePost(app, helpers)))
+	router.Handler(http.MethodPost, "/snippet/comment/:id", dynamic.ThenFunc(CommentCreatePost(app, helpers)))
+	router.Handler(http.MethodPost, "/snippet/report/:id", dynamic.ThenFunc(SnippetReportPost(app, helpers)))
+	router.Handler(http.MethodGet, "/test/login", dynamic.ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.SessionManager.Put(r.Context(), "authenticatedUserID", 1)
+	}))
+
+	ts := httptest.NewServer(router)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// testClient returns a client for ts which keeps its cookies and doesn't
+// follow redirects.
+func testClient(t *testing.T, ts *httptest.Server) *http.Client {
+	t.Helper()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Client{
+		Jar: jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// do sends a request and returns the status code and body of the response.
+func do(t *testing.T, client *http.Client, method, target string, form url.Values) (int, string) {
+	t.Helper()
+
+	var res *http.Response
+	var err error
+	if method == http.MethodPost {
+		res, err = client.PostForm(target, form)
+	} else {
+		res, err = client.Get(target)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.StatusCode, string(body)
+}
+
+// fieldErrorRX matches an error label and the name of the first form control
+// after it.
+var fieldErrorRX = regexp.MustCompile(`(?s)<label class="error">([^<]*)</label>.*?\bname='([^']*)'`)
+
+// fieldErrors returns the error messages on a page, keyed by the name of the
+// form control each one is shown next to.
+func fieldErrors(body string) map[string]string {
+	errs := map[string]string{}
+	for _, m := range fieldErrorRX.FindAllStringSubmatch(body, -1) {
+		errs[m[2]] = html.UnescapeString(m[1])
+	}
+	return errs
+}
+
+func checkFieldErrors(t *testing.T, body string, want map[string]string) {
+	t.Helper()
+
+	got := fieldErrors(body)
+	for field, msg := range want {
+		if got[field] != msg {
+			t.Errorf("%s: got error %q; want %q", field, got[field], msg)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("got errors %v; want %v", got, want)
+	}
+}
+
+func TestSnippetCreatePostInvalid(t *testing.T) {
+	ts := testServer(t)
+	client := testClient(t, ts)
+
+	form := url.Values{
+		"title":             {""},
+		"files[0].name":     {"haiku.txt"},
+		"files[0].language": {"text"},
+		"files[0].content":  {"An old silent pond"},
+		"files[1].name":     {"haiku.txt"},
+		"files[1].language": {"cobol"},
+		"files[1].content":  {""},
+		"tags":              {"poems, haiku!"},
+		"expires":           {"48h0m0s"},
+		"max_views":         {"5000"},
+		"notify_email":      {"frog"},
+		"visibility":        {"private"},
+		"password":          {strings.Repeat("x", 73)},
+	}
+
+	code, body := do(t, client, http.MethodPost, ts.URL+"/snippet/create", form)
+	if code != http.StatusUnprocessableEntity {
+		t.Fatalf("got status %d; want %d", code, http.StatusUnprocessableEntity)
+	}
+
+	checkFieldErrors(t, body, map[string]string{
+		"title":             "This field cannot be blank",
+		"files[0].name":     "Each file must have a different name",
+		"files[1].language": "This field must be one of the listed languages",
+		"files[1].content":  "This field cannot be blank",
+		"tags":              "Tags can only contain letters, digits and the characters + # . -",
+		"expires":           "This field must be one of the listed options",
+		"max_views":         "This field must be between 0 and 1000",
+		"notify_email":      "This field must be a valid email address",
+		"visibility":        "Log in to create private snippets",
+		"password":          "This field cannot be more than 72 bytes long",
+	})
+
+	// The submitted values are kept, apart from the password.
+	for _, want := range []string{`value='poems, haiku!'`, `>An old silent pond</textarea>`, `value='5000'`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("%q is missing from the form", want)
+		}
+	}
+}
+
+func TestCommentCreatePostInvalid(t *testing.T) {
+	ts := testServer(t)
+	client := testClient(t, ts)
+	do(t, client, http.MethodGet, ts.URL+"/test/login", nil)
+
+	tests := []struct {
+		name string
+		form url.Values
+		want map[string]string
+	}{
+		{
+			name: "Empty body",
+			form: url.Values{"body": {" "}},
+			want: map[string]string{"body": "This field cannot be blank"},
+		},
+		{
+			name: "Lines outside the file",
+			form: url.Values{"body": {"Nice"}, "file_id": {"1"}, "line_start": {"2"}, "line_end": {"5"}},
+			want: map[string]string{"file_id": "The lines must be a range between 1 and 2"},
+		},
+		{
+			name: "Unknown file",
+			form: url.Values{"body": {strings.Repeat("x", 5001)}, "file_id": {"9"}, "line_start": {"1"}},
+			want: map[string]string{
+				"file_id": "This file is not part of the snippet",
+				"body":    "This field cannot be more than 5000 characters long",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := do(t, client, http.MethodPost, ts.URL+"/snippet/comment/1", tt.form)
+			if code != http.StatusUnprocessableEntity {
+				t.Fatalf("got status %d; want %d", code, http.StatusUnprocessableEntity)
+			}
+			checkFieldErrors(t, body, tt.want)
+		})
+	}
+}
+
+func TestSnippetReportPostInvalid(t *testing.T) {
+	ts := testServer(t)
+	client := testClient(t, ts)
+
+	tests := []struct {
+		name string
+		form url.Values
+		want string
+	}{
+		{
+			name: "No reason",
+			form: url.Values{"details": {"Rude"}},
+			want: "Please choose a reason",
+		},
+		{
+			name: "Long details",
+			form: url.Values{"reason": {models.ReportReasons[0].Value}, "details": {strings.Repeat("x", 1001)}},
+			want: "This field cannot be more than 1000 characters long",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _ := do(t, client, http.MethodPost, ts.URL+"/snippet/report/1", tt.form)
+			if code != http.StatusSeeOther {
+				t.Fatalf("got status %d; want %d", code, http.StatusSeeOther)
+			}
+
+			// The report form is on the view page, which shows the error in
+			// a flash message.
+			_, body := do(t, client, http.MethodGet, ts.URL+"/snippet/view/1", nil)
+			if !strings.Contains(html.UnescapeString(body), tt.want) {
+				t.Errorf("%q is missing from the page", tt.want)
+			}
+		})
+	}
+}
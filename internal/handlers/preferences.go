@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode"
+
+	"github.com/Hiwiii/snippetbox.git/config"
+	"github.com/Hiwiii/snippetbox.git/internal/forms"
+	"github.com/Hiwiii/snippetbox.git/internal/i18n"
+	"github.com/Hiwiii/snippetbox.git/internal/middleware"
+)
+
+// LocalePost stores the locale picked in the language picker in the session,
+// or forgets it so that Accept-Language is used again if "automatic" was
+// picked. It returns to the page the picker was on.
+func LocalePost(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var form forms.LocaleForm
+
+		err := helpers.DecodePostForm(r, &form)
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		switch {
+		case form.Locale == "":
+			app.SessionManager.Remove(r.Context(), "locale")
+		case helpers.I18n.Supported(form.Locale):
+			app.SessionManager.Put(r.Context(), "locale", form.Locale)
+		default:
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		http.Redirect(w, r, localPath(form.Next), http.StatusSeeOther)
+	}
+}
+
+// TimezonePost stores the time zone entered in the footer in the session, or
+// forgets it so that the zone detected in the browser is used again if the
+// field was left empty. It returns to the page the form was on.
+func TimezonePost(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var form forms.TimezoneForm
+
+		err := helpers.DecodePostForm(r, &form)
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		name := strings.TrimSpace(form.Timezone)
+		if name == "" {
+			app.SessionManager.Remove(r.Context(), "timezone")
+		} else if _, err := i18n.LoadZone(name); err != nil {
+			// The field is typed in by hand, so a mistake deserves an
+			// explanation rather than a 400.
+			app.SessionManager.Put(r.Context(), "flash", helpers.Localizer(r).T("flash.timezone_invalid", name))
+		} else {
+			app.SessionManager.Put(r.Context(), "timezone", name)
+		}
+
+		http.Redirect(w, r, localPath(form.Next), http.StatusSeeOther)
+	}
+}
+
+// localPath returns next if it is a path on this site, or "/" otherwise, so
+// that redirecting to it can't send visitors to another site. Browsers ignore
+// tabs and newlines in URLs and read backslashes as slashes, so paths which
+// contain control characters, even percent-encoded ones, or which start with
+// two slashes of either kind are refused too.
+func localPath(next string) string {
+	u, err := url.Parse(next)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Opaque != "" {
+		return "/"
+	}
+
+	for _, p := range []string{next, u.Path} {
+		if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.HasPrefix(p, "/\\") {
+			return "/"
+		}
+		if strings.ContainsFunc(p, unicode.IsControl) {
+			return "/"
+		}
+	}
+	return next
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import "testing"
+
+func TestLocalPath(t *testing.T) {
+	tests := map[string]string{
+		"/":                        "/",
+		"/snippet/view/1":          "/snippet/view/1",
+		"/snippet/view/1?page=2#c": "/snippet/view/1?page=2#c",
+		"/search?q=a%2Fb":          "/search?q=a%2Fb",
+		"":                         "/",
+		"snippet/view/1":           "/",
+		"https://evil.com":         "/",
+		"//evil.com":               "/",
+		"/\\evil.com":              "/",
+		"/%5Cevil.com":             "/",
+		"/%2Fevil.com":             "/",
+		"/%09/evil.com":            "/",
+		"/\t/evil.com":             "/",
+		"/\n/evil.com":             "/",
+		"/%0d%0aSet-Cookie:x=1":    "/",
+		"javascript:alert(1)":      "/",
+		"/%zz":                     "/",
+	}
+
+	for next, want := range tests {
+		if got := localPath(next); got != want {
+			t.Errorf("localPath(%q) = %q; want %q", next, got, want)
+		}
+	}
+}
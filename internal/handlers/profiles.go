@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif"  // decode GIF avatars
+	_ "image/jpeg" // decode JPEG avatars
+	_ "image/png"  // decode PNG avatars
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/Hiwiii/snippetbox.git/config"
+	"github.com/Hiwiii/snippetbox.git/internal/forms"
+	"github.com/Hiwiii/snippetbox.git/internal/middleware"
+	"github.com/Hiwiii/snippetbox.git/internal/models"
+	"github.com/Hiwiii/snippetbox.git/internal/templates"
+	"github.com/Hiwiii/snippetbox.git/internal/validators"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// pageSize is the number of snippets listed per page.
+const pageSize = 20
+
+// maxAvatarBytes is the largest avatar image which can be uploaded. The whole
+// profile form may be a little larger, to leave room for the other fields.
+const (
+	maxAvatarBytes      = 512 << 10
+	maxProfileFormBytes = maxAvatarBytes + 64<<10
+)
+
+// UserProfile shows a user's profile and lists their public snippets, a page
+// at a time. Disabled users have no profile.
+func UserProfile(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+		username := params.ByName("username")
+		if !validator.Matches(username, models.UsernameRX) {
+			helpers.NotFound(w)
+			return
+		}
+
+		page, ok := pageNumber(r)
+		if !ok {
+			helpers.NotFound(w)
+			return
+		}
+
+		user, err := app.UserModel.GetByUsername(username)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				helpers.NotFound(w)
+			} else {
+				helpers.ServerError(w, err)
+			}
+			return
+		}
+		if user.Disabled {
+			helpers.NotFound(w)
+			return
+		}
+
+		// Fetch one snippet more than fits on the page to know whether
+		// there is a next page.
+		snippets, err := app.SnippetModel.ByUser(user.ID, false, pageSize+1, (page-1)*pageSize)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		data := helpers.NewTemplateData(r)
+		data.Profile = user
+		paginate(data, page, snippets)
+
+		helpers.Render(w, r, http.StatusOK, "profile.tmpl", data)
+	}
+}
+
+// UserAvatar sends the avatar image of a user.
+func UserAvatar(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+		username := params.ByName("username")
+		if !validator.Matches(username, models.UsernameRX) {
+			helpers.NotFound(w)
+			return
+		}
+
+		avatar, contentType, err := app.UserModel.Avatar(username)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				helpers.NotFound(w)
+			} else {
+				helpers.ServerError(w, err)
+			}
+			return
+		}
+
+		// The content type was checked against the image itself when it was
+		// uploaded, and nosniff stops browsers from guessing another one.
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(avatar)))
+		w.Write(avatar)
+	}
+}
+
+// AccountProfile shows the form for editing the logged in user's profile.
+func AccountProfile(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := helpers.AuthenticatedUser(r)
+
+		data := helpers.NewTemplateData(r)
+		data.Profile = user
+		data.Form = forms.ProfileForm{Name: user.Name, Bio: user.Bio}
+
+		helpers.Render(w, r, http.StatusOK, "account_profile.tmpl", data)
+	}
+}
+
+// AccountProfilePost updates the display name, bio and avatar of the logged
+// in user. Avatars must be PNG, JPEG or GIF images no larger than
+// maxAvatarBytes; the type is taken from the image data rather than from what
+// the browser claims.
+func AccountProfilePost(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loc := helpers.Localizer(r)
+		user := helpers.AuthenticatedUser(r)
+
+		// Refuse oversized uploads before reading all of them. On the real
+		// routes VerifyCSRF has read the form already, within a larger limit,
+		// and the size of the avatar is checked below.
+		r.Body = http.MaxBytesReader(w, r.Body, maxProfileFormBytes)
+		err := r.ParseMultipartForm(maxProfileFormBytes)
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			if errors.As(err, &maxBytesError) {
+				helpers.ClientError(w, http.StatusRequestEntityTooLarge)
+			} else {
+				helpers.ClientError(w, http.StatusBadRequest)
+			}
+			return
+		}
+
+		var form forms.ProfileForm
+
+		err = helpers.DecodePostForm(r, &form)
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		form.CheckStruct(&form, validationMessage(loc))
+
+		avatar, err := readAvatar(r)
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+		var contentType string
+		if avatar != nil {
+			contentType = http.DetectContentType(avatar)
+			_, _, decodeErr := image.DecodeConfig(bytes.NewReader(avatar))
+
+			form.CheckField(len(avatar) <= maxAvatarBytes, "avatar", loc.T("validation.avatar_size", maxAvatarBytes>>10))
+			form.CheckField(validator.PermittedValue(contentType, models.AvatarTypes...) && decodeErr == nil, "avatar", loc.T("validation.avatar_type"))
+		}
+
+		if !form.Valid() {
+			data := helpers.NewTemplateData(r)
+			data.Profile = user
+			data.Form = form
+			helpers.Render(w, r, http.StatusUnprocessableEntity, "account_profile.tmpl", data)
+			return
+		}
+
+		err = app.UserModel.UpdateProfile(user.ID, form.Name, form.Bio)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		if avatar != nil || form.RemoveAvatar {
+			err = app.UserModel.SetAvatar(user.ID, avatar, contentType)
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+		}
+
+		app.SessionManager.Put(r.Context(), "flash", loc.T("flash.profile_updated"))
+
+		http.Redirect(w, r, "/user/"+url.PathEscape(user.Username), http.StatusSeeOther)
+	}
+}
+
+// readAvatar returns the image uploaded in the avatar field of a multipart
+// form, or nil if no file was chosen. At most one byte more than
+// maxAvatarBytes is read, which is enough to tell that it is too large.
+func readAvatar(r *http.Request) ([]byte, error) {
+	file, _, err := r.FormFile("avatar")
+	if err != nil {
+		if errors.Is(err, http.ErrMissingFile) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	avatar, err := io.ReadAll(io.LimitReader(file, maxAvatarBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(avatar) == 0 {
+		return nil, nil
+	}
+	return avatar, nil
+}
+
+// pageNumber returns the number in the page query parameter, or 1 if there is
+// none. ok is false if it isn't a positive number.
+func pageNumber(r *http.Request) (page int, ok bool) {
+	s := r.URL.Query().Get("page")
+	if s == "" {
+		return 1, true
+	}
+
+	page, err := strconv.Atoi(s)
+	if err != nil || page < 1 {
+		return 0, false
+	}
+	return page, true
+}
+
+// paginate sets the snippets of a page, which were fetched with one extra
+// snippet past its end, and the numbers of the pages before and after it.
+func paginate(data *templates.TemplateData, page int, snippets []*models.Snippet) {
+	if page > 1 {
+		data.PrevPage = page - 1
+	}
+	if len(snippets) > pageSize {
+		snippets = snippets[:pageSize]
+		data.NextPage = page + 1
+	}
+	data.Snippets = snippets
+}
@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Hiwiii/snippetbox.git/config"
+	"github.com/Hiwiii/snippetbox.git/internal/audit"
+	"github.com/Hiwiii/snippetbox.git/internal/forms"
+	"github.com/Hiwiii/snippetbox.git/internal/middleware"
+	"github.com/Hiwiii/snippetbox.git/internal/models"
+	"github.com/Hiwiii/snippetbox.git/internal/validators"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// SnippetReportPost reports a snippet to the moderators. Once a snippet has
+// app.ReportLimit open reports from different people it is hidden until a
+// moderator looks at it.
+func SnippetReportPost(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loc := helpers.Localizer(r)
+
+		params := httprouter.ParamsFromContext(r.Context())
+		id, err := strconv.Atoi(params.ByName("id"))
+		if err != nil || id < 1 {
+			helpers.NotFound(w)
+			return
+		}
+
+		snippet, err := app.SnippetModel.Get(id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				helpers.NotFound(w)
+			} else {
+				helpers.ServerError(w, err)
+			}
+			return
+		}
+
+		// Private snippets don't exist for anyone but their author.
+		if !helpers.SnippetVisible(r, snippet) {
+			helpers.NotFound(w)
+			return
+		}
+
+		// Only people who can see the snippet can report it.
+		if !helpers.SnippetUnlocked(r, snippet) {
+			http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+			return
+		}
+
+		var form forms.ReportForm
+
+		err = helpers.DecodePostForm(r, &form)
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		form.CheckField(validator.PermittedValue(form.Reason, models.PermittedReportReasons()...), "reason", loc.T("validation.reason"))
+		form.CheckStruct(&form, validationMessage(loc))
+
+		// The report form lives on the view page, so report problems with a
+		// flash message like the extend form does.
+		if !form.Valid() {
+			msg, ok := form.FieldErrors["reason"]
+			if !ok {
+				msg = form.FieldErrors["details"]
+			}
+			app.SessionManager.Put(r.Context(), "flash", loc.T("flash.report_not_sent", msg))
+			http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+			return
+		}
+
+		// Reports are independent if they come from different users or, for
+		// visitors who aren't logged in, different IP addresses.
+		reporter := "ip:" + helpers.ClientIP(r)
+		if userID := helpers.AuthenticatedUserID(r); userID > 0 {
+			reporter = fmt.Sprintf("user:%d", userID)
+		}
+
+		open, err := app.ReportModel.Insert(snippet.ID, form.Reason, form.Details, reporter)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		app.SessionManager.Put(r.Context(), "flash", loc.T("flash.report_sent"))
+
+		if app.ReportLimit > 0 && open >= app.ReportLimit {
+			err = app.SnippetModel.SetHidden(snippet.ID, true)
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+
+			err = app.Moderation.Record(&models.ModerationAction{
+				Action:    models.ActionAutoHide,
+				SnippetID: snippet.ID,
+				Note:      fmt.Sprintf("%d open reports", open),
+			})
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+	}
+}
+
+// AdminReports shows the moderation queue: snippets with open reports.
+func AdminReports(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		queue, err := app.ReportModel.Queue()
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		data := helpers.NewTemplateData(r)
+		data.ReportQueue = queue
+
+		helpers.Render(w, r, http.StatusOK, "admin_reports.tmpl", data)
+	}
+}
+
+// AdminReportPost resolves the open reports about a snippet. The action is
+// taken from the "action" form field:
+//
+//   - "dismiss" closes the reports and shows the snippet again if it was hidden
+//   - "hide" hides the snippet
+//   - "delete" deletes the snippet
+//   - "ban" disables the author's account and hides the snippet
+//
+// Every action is recorded in the moderation log, along with the optional
+// "note" form field.
+func AdminReportPost(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loc := helpers.Localizer(r)
+
+		params := httprouter.ParamsFromContext(r.Context())
+		id, err := strconv.Atoi(params.ByName("id"))
+		if err != nil || id < 1 {
+			helpers.NotFound(w)
+			return
+		}
+
+		reported, err := app.ReportModel.Open(id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				helpers.NotFound(w)
+			} else {
+				helpers.ServerError(w, err)
+			}
+			return
+		}
+
+		err = r.ParseForm()
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		note := r.PostForm.Get("note")
+		if !validator.MaxChars(note, 255) {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		moderator := helpers.AuthenticatedUser(r)
+		action := &models.ModerationAction{
+			ModeratorID: moderator.ID,
+			Action:      r.PostForm.Get("action"),
+			SnippetID:   reported.SnippetID,
+			Note:        note,
+		}
+
+		var flash string
+
+		switch action.Action {
+		case models.ActionDismiss:
+			if reported.Hidden {
+				err = app.SnippetModel.SetHidden(reported.SnippetID, false)
+			}
+			flash = loc.T("flash.reports_dismissed")
+		case models.ActionHide:
+			err = app.SnippetModel.SetHidden(reported.SnippetID, true)
+			flash = loc.T("flash.snippet_hidden")
+		case models.ActionDelete:
+			err = app.SnippetModel.Delete(reported.SnippetID)
+			flash = loc.T("flash.snippet_deleted")
+		case models.ActionBan:
+			if reported.UserID == 0 {
+				app.SessionManager.Put(r.Context(), "flash", loc.T("flash.no_author"))
+				http.Redirect(w, r, "/admin/reports", http.StatusSeeOther)
+				return
+			}
+
+			author, err := app.UserModel.Get(reported.UserID)
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+
+			// Moderators can't ban their peers or admins.
+			if author.ID == moderator.ID || author.Role.AtLeast(moderator.Role) {
+				helpers.ClientError(w, http.StatusForbidden)
+				return
+			}
+
+			action.TargetUserID = author.ID
+			err = app.UserModel.SetDisabled(author.ID, true)
+			if err == nil {
+				err = app.SnippetModel.SetHidden(reported.SnippetID, true)
+			}
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+			flash = loc.T("flash.author_banned", author.Name)
+		default:
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		// Deleting the snippet also deletes its reports.
+		if action.Action != models.ActionDelete {
+			err = app.ReportModel.Resolve(reported.SnippetID, action.Action)
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+		}
+
+		err = app.Moderation.Record(action)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		var event *models.AuditEvent
+		if action.Action == models.ActionDelete {
+			event = helpers.AuditEvent(r, models.AuditSnippetDelete, audit.Snippet(reported.SnippetID))
+			event.Details = note
+		} else {
+			event = helpers.AuditEvent(r, models.AuditAdminAction, audit.Snippet(reported.SnippetID))
+			event.Details = strings.TrimSpace(action.Action + " " + note)
+		}
+		recordAudit(app, event)
+
+		app.SessionManager.Put(r.Context(), "flash", flash)
+
+		http.Redirect(w, r, "/admin/reports", http.StatusSeeOther)
+	}
+}
+
+// AdminModerationLog shows the most recent moderation actions.
+func AdminModerationLog(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		actions, err := app.Moderation.Latest()
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		data := helpers.NewTemplateData(r)
+		data.ModerationActions = actions
+
+		helpers.Render(w, r, http.StatusOK, "admin_log.tmpl", data)
+	}
+}
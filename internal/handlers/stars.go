@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Hiwiii/snippetbox.git/config"
+	"github.com/Hiwiii/snippetbox.git/internal/middleware"
+	"github.com/Hiwiii/snippetbox.git/internal/models"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// SnippetStarPost stars a snippet for the logged in user.
+func SnippetStarPost(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return starHandler(app, helpers, true)
+}
+
+// SnippetUnstarPost removes the logged in user's star from a snippet.
+func SnippetUnstarPost(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return starHandler(app, helpers, false)
+}
+
+// starHandler stars or unstars a snippet which the user is allowed to see,
+// and returns to the snippet. The routes require a logged in user.
+func starHandler(app *config.Application, helpers *middleware.Helpers, star bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loc := helpers.Localizer(r)
+
+		params := httprouter.ParamsFromContext(r.Context())
+		id, err := strconv.Atoi(params.ByName("id"))
+		if err != nil || id < 1 {
+			helpers.NotFound(w)
+			return
+		}
+
+		snippet, err := app.SnippetModel.Get(id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				helpers.NotFound(w)
+			} else {
+				helpers.ServerError(w, err)
+			}
+			return
+		}
+
+		// Private snippets don't exist for anyone but their author.
+		if !helpers.SnippetVisible(r, snippet) {
+			helpers.NotFound(w)
+			return
+		}
+
+		// Only people who can see the snippet can star it.
+		if !helpers.SnippetUnlocked(r, snippet) {
+			http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+			return
+		}
+
+		userID := helpers.AuthenticatedUserID(r)
+		flash := loc.T("flash.starred")
+		if star {
+			err = app.StarModel.Add(userID, snippet.ID)
+		} else {
+			err = app.StarModel.Remove(userID, snippet.ID)
+			flash = loc.T("flash.unstarred")
+		}
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		app.SessionManager.Put(r.Context(), "flash", flash)
+
+		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+	}
+}
+
+// StarredSnippets lists the snippets the logged in user has starred.
+func StarredSnippets(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snippets, err := app.StarModel.Starred(helpers.AuthenticatedUserID(r))
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		data := helpers.NewTemplateData(r)
+		data.Snippets = snippets
+
+		helpers.Render(w, r, http.StatusOK, "starred.tmpl", data)
+	}
+}
@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Hiwiii/snippetbox.git/config"
+	"github.com/Hiwiii/snippetbox.git/internal/audit"
+	"github.com/Hiwiii/snippetbox.git/internal/forms"
+	"github.com/Hiwiii/snippetbox.git/internal/middleware"
+	"github.com/Hiwiii/snippetbox.git/internal/models"
+	"github.com/Hiwiii/snippetbox.git/internal/totp"
+)
+
+const (
+	// totpIssuer is the name authenticator apps show next to the codes.
+	totpIssuer = "Snippetbox"
+	// recoveryCodeCount is the number of recovery codes a user gets when
+	// they turn on two-factor authentication.
+	recoveryCodeCount = 10
+	// twoFactorTimeout is how long users have to enter a code after logging
+	// in with the identity provider.
+	twoFactorTimeout = 5 * time.Minute
+)
+
+// AccountTwoFactor shows the two-factor authentication settings of the
+// logged in user. Users who haven't turned it on get a secret to add to their
+// authenticator app, which is kept in the session until they confirm it with
+// a code.
+func AccountTwoFactor(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := helpers.AuthenticatedUser(r)
+
+		data := helpers.NewTemplateData(r)
+		data.Form = forms.TwoFactorForm{}
+
+		if user.TwoFactor {
+			left, err := app.TwoFactorModel.RecoveryCodesLeft(user.ID)
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+			data.RecoveryCodesLeft = left
+		} else {
+			// Keep the same secret when the page is reloaded, in case it
+			// has already been added to the app.
+			secret := app.SessionManager.GetString(r.Context(), "totpSecret")
+			if secret == "" {
+				var err error
+				secret, err = totp.GenerateSecret()
+				if err != nil {
+					helpers.ServerError(w, err)
+					return
+				}
+				app.SessionManager.Put(r.Context(), "totpSecret", secret)
+			}
+			data.TOTPSecret = secret
+			data.TOTPURI = totpURI(user, secret)
+		}
+
+		helpers.Render(w, r, http.StatusOK, "account_2fa.tmpl", data)
+	}
+}
+
+// AccountTwoFactorPost turns on two-factor authentication once the user has
+// entered a code for the secret shown on the settings page. The recovery
+// codes are shown once, in the response, and only their hashes are stored.
+func AccountTwoFactorPost(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loc := helpers.Localizer(r)
+		user := helpers.AuthenticatedUser(r)
+
+		secret := app.SessionManager.GetString(r.Context(), "totpSecret")
+		if user.TwoFactor || secret == "" {
+			http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+			return
+		}
+
+		var form forms.TwoFactorForm
+
+		err := helpers.DecodePostForm(r, &form)
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		form.CheckStruct(&form, validationMessage(loc))
+
+		step, ok := totp.Validate(secret, form.Code, time.Now(), -1)
+		form.CheckField(ok, "code", loc.T("validation.two_factor_code"))
+
+		if !form.Valid() {
+			data := helpers.NewTemplateData(r)
+			data.Form = form
+			data.TOTPSecret = secret
+			data.TOTPURI = totpURI(user, secret)
+			helpers.Render(w, r, http.StatusUnprocessableEntity, "account_2fa.tmpl", data)
+			return
+		}
+
+		codes, err := totp.GenerateRecoveryCodes(recoveryCodeCount)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		hashes := make([][]byte, len(codes))
+		for i, code := range codes {
+			hashes[i] = totp.HashRecoveryCode(code)
+		}
+
+		err = app.TwoFactorModel.Enable(user.ID, secret, step, hashes)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		app.SessionManager.Remove(r.Context(), "totpSecret")
+
+		recordAudit(app, helpers.AuditEvent(r, models.AuditTwoFactorOn, audit.User(user.ID)))
+
+		data := helpers.NewTemplateData(r)
+		data.RecoveryCodes = codes
+		helpers.Render(w, r, http.StatusOK, "account_2fa.tmpl", data)
+	}
+}
+
+// AccountTwoFactorDisablePost turns off two-factor authentication, after
+// checking a code from the authenticator app or a recovery code.
+func AccountTwoFactorDisablePost(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loc := helpers.Localizer(r)
+		user := helpers.AuthenticatedUser(r)
+
+		if !user.TwoFactor {
+			http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+			return
+		}
+
+		if !app.LoginLimiter.Allow(strconv.Itoa(user.ID)) {
+			helpers.ClientError(w, http.StatusTooManyRequests)
+			return
+		}
+
+		var form forms.TwoFactorForm
+
+		err := helpers.DecodePostForm(r, &form)
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		form.CheckStruct(&form, validationMessage(loc))
+		if form.Valid() {
+			ok, err := checkTwoFactorCode(app, user.ID, form.Code)
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+			form.CheckField(ok, "code", loc.T("validation.two_factor_code"))
+		}
+
+		if !form.Valid() {
+			left, err := app.TwoFactorModel.RecoveryCodesLeft(user.ID)
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+
+			data := helpers.NewTemplateData(r)
+			data.Form = form
+			data.RecoveryCodesLeft = left
+			helpers.Render(w, r, http.StatusUnprocessableEntity, "account_2fa.tmpl", data)
+			return
+		}
+		app.LoginLimiter.Reset(strconv.Itoa(user.ID))
+
+		err = app.TwoFactorModel.Disable(user.ID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		recordAudit(app, helpers.AuditEvent(r, models.AuditTwoFactorOff, audit.User(user.ID)))
+
+		app.SessionManager.Put(r.Context(), "flash", loc.T("flash.two_factor_disabled"))
+
+		http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+	}
+}
+
+// UserLoginTwoFactor asks for a code from the authenticator app of a user
+// who has logged in with the identity provider but not yet entered one.
+func UserLoginTwoFactor(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if pendingTwoFactorUserID(app, r) == 0 {
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		data := helpers.NewTemplateData(r)
+		data.Form = forms.TwoFactorForm{}
+
+		helpers.Render(w, r, http.StatusOK, "login_2fa.tmpl", data)
+	}
+}
+
+// UserLoginTwoFactorPost completes the login of a user with two-factor
+// authentication once they have entered a code from their authenticator app
+// or one of their recovery codes.
+func UserLoginTwoFactorPost(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loc := helpers.Localizer(r)
+
+		userID := pendingTwoFactorUserID(app, r)
+		if userID == 0 {
+			app.SessionManager.Put(r.Context(), "flash", loc.T("flash.two_factor_expired"))
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		// Count every code before checking it, so that the six digits can't
+		// be guessed.
+		if !app.LoginLimiter.Allow(strconv.Itoa(userID)) {
+			helpers.ClientError(w, http.StatusTooManyRequests)
+			return
+		}
+
+		var form forms.TwoFactorForm
+
+		err := helpers.DecodePostForm(r, &form)
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		form.CheckStruct(&form, validationMessage(loc))
+		if form.Valid() {
+			ok, err := checkTwoFactorCode(app, userID, form.Code)
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+			form.CheckField(ok, "code", loc.T("validation.two_factor_code"))
+		}
+
+		if !form.Valid() {
+			event := helpers.AuditEvent(r, models.AuditLoginFailure, audit.User(userID))
+			event.Details = "wrong two-factor code"
+			recordAudit(app, event)
+
+			data := helpers.NewTemplateData(r)
+			data.Form = form
+			helpers.Render(w, r, http.StatusUnprocessableEntity, "login_2fa.tmpl", data)
+			return
+		}
+		app.LoginLimiter.Reset(strconv.Itoa(userID))
+
+		user, err := app.UserModel.Get(userID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		issuer := app.SessionManager.PopString(r.Context(), "twoFactorIssuer")
+		email := app.SessionManager.PopString(r.Context(), "twoFactorEmail")
+		app.SessionManager.Remove(r.Context(), "twoFactorUserID")
+		app.SessionManager.Remove(r.Context(), "twoFactorExpires")
+
+		completeLogin(w, r, app, helpers, user, email, issuer+", two-factor")
+	}
+}
+
+// totpURI returns the otpauth:// URI for adding a user's secret to an
+// authenticator app. html/template would otherwise refuse to link to it,
+// since it only trusts http, https and mailto URLs.
+func totpURI(user *models.User, secret string) template.URL {
+	return template.URL(totp.URI(totpIssuer, user.Username, secret))
+}
+
+// pendingTwoFactorUserID returns the ID of the user who still has to enter a
+// two-factor code to log in, or 0 if there is none or they took too long.
+func pendingTwoFactorUserID(app *config.Application, r *http.Request) int {
+	if time.Now().Unix() > app.SessionManager.GetInt64(r.Context(), "twoFactorExpires") {
+		return 0
+	}
+	return app.SessionManager.GetInt(r.Context(), "twoFactorUserID")
+}
+
+// checkTwoFactorCode returns true if code is the current code from the
+// user's authenticator app, or one of their recovery codes, which is then
+// used up.
+func checkTwoFactorCode(app *config.Application, userID int, code string) (bool, error) {
+	ok, err := app.TwoFactorModel.Verify(userID, code, time.Now())
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return false, nil
+		}
+		return false, err
+	}
+	if ok {
+		return true, nil
+	}
+
+	return app.TwoFactorModel.UseRecoveryCode(userID, code)
+}
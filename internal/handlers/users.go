@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Hiwiii/snippetbox.git/config"
+	"github.com/Hiwiii/snippetbox.git/internal/audit"
+	"github.com/Hiwiii/snippetbox.git/internal/middleware"
+	"github.com/Hiwiii/snippetbox.git/internal/models"
+	"github.com/Hiwiii/snippetbox.git/internal/oidc"
+)
+
+// UserLoginOIDC starts a single sign-on login by redirecting to the identity
+// provider. The state, nonce and PKCE verifier are kept in the session until
+// the provider redirects back.
+func UserLoginOIDC(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.OIDC == nil {
+			helpers.NotFound(w)
+			return
+		}
+
+		req, err := oidc.NewAuthRequest()
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		app.SessionManager.Put(r.Context(), "oidcState", req.State)
+		app.SessionManager.Put(r.Context(), "oidcNonce", req.Nonce)
+		app.SessionManager.Put(r.Context(), "oidcVerifier", req.Verifier)
+
+		http.Redirect(w, r, app.OIDC.AuthCodeURL(req), http.StatusSeeOther)
+	}
+}
+
+// UserLoginOIDCCallback completes a single sign-on login. The verified
+// identity is linked to a local user, creating one on the first login.
+func UserLoginOIDCCallback(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loc := helpers.Localizer(r)
+
+		if app.OIDC == nil {
+			helpers.NotFound(w)
+			return
+		}
+
+		// Pop the values so that a callback can only be used once.
+		req := &oidc.AuthRequest{
+			State:    app.SessionManager.PopString(r.Context(), "oidcState"),
+			Nonce:    app.SessionManager.PopString(r.Context(), "oidcNonce"),
+			Verifier: app.SessionManager.PopString(r.Context(), "oidcVerifier"),
+		}
+
+		id, err := app.OIDC.Callback(r.Context(), r.URL.Query(), req)
+		if err != nil {
+			event := helpers.AuditEvent(r, models.AuditLoginFailure, "")
+			event.Details = err.Error()
+			recordAudit(app, event)
+
+			switch {
+			case errors.Is(err, oidc.ErrStateMismatch):
+				helpers.ClientError(w, http.StatusBadRequest)
+			case errors.Is(err, oidc.ErrDomainNotAllowed):
+				app.SessionManager.Put(r.Context(), "flash", loc.T("flash.login_not_allowed"))
+				http.Redirect(w, r, "/", http.StatusSeeOther)
+			default:
+				app.ErrorLog.Printf("single sign-on failed: %v", err)
+				app.SessionManager.Put(r.Context(), "flash", loc.T("flash.login_failed"))
+				http.Redirect(w, r, "/", http.StatusSeeOther)
+			}
+			return
+		}
+
+		// Only verified addresses are stored, since they are used to link
+		// identities to existing users.
+		email := ""
+		if id.EmailVerified {
+			email = strings.ToLower(id.Email)
+		}
+
+		name := id.Name
+		if name == "" {
+			name = email
+		}
+		if name == "" {
+			name = id.Subject
+		}
+
+		userID, err := app.UserModel.LoginOIDC(id.Issuer, id.Subject, name, email)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		user, err := app.UserModel.Get(userID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		if user.Disabled {
+			event := helpers.AuditEvent(r, models.AuditLoginFailure, audit.User(user.ID))
+			event.Details = "account disabled"
+			recordAudit(app, event)
+
+			app.SessionManager.Put(r.Context(), "flash", loc.T("flash.account_disabled"))
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		// Users with two-factor authentication still have to enter a code.
+		// Until they do, the session only remembers who they are, for a few
+		// minutes, and they aren't logged in.
+		if user.TwoFactor {
+			err = app.SessionManager.RenewToken(r.Context())
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+
+			app.SessionManager.Put(r.Context(), "twoFactorUserID", userID)
+			app.SessionManager.Put(r.Context(), "twoFactorIssuer", id.Issuer)
+			app.SessionManager.Put(r.Context(), "twoFactorEmail", email)
+			app.SessionManager.Put(r.Context(), "twoFactorExpires", time.Now().Add(twoFactorTimeout).Unix())
+
+			http.Redirect(w, r, "/login/2fa", http.StatusSeeOther)
+			return
+		}
+
+		completeLogin(w, r, app, helpers, user, email, id.Issuer)
+	}
+}
+
+// completeLogin logs a user in to the current session, once they have been
+// authenticated, and records details about how in the audit log. email is the
+// verified address the identity provider returned, if any.
+func completeLogin(w http.ResponseWriter, r *http.Request, app *config.Application, helpers *middleware.Helpers, user *models.User, email, details string) {
+	loc := helpers.Localizer(r)
+
+	// Users with a configured admin address become admins when they log
+	// in, so that there is a way to get the first admin. This waits until
+	// any second factor has been checked.
+	if email != "" && app.AdminEmails[email] && user.Role != models.RoleAdmin {
+		err := app.UserModel.SetRole(user.ID, models.RoleAdmin)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	// Renew the session token when the privilege level changes, to
+	// prevent session fixation.
+	err := app.SessionManager.RenewToken(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// The user isn't in the request context yet, so set the actor here.
+	event := helpers.AuditEvent(r, models.AuditLoginSuccess, audit.User(user.ID))
+	event.ActorID = user.ID
+	event.Details = details
+	recordAudit(app, event)
+
+	app.SessionManager.Put(r.Context(), "authenticatedUserID", user.ID)
+	app.SessionManager.Put(r.Context(), "flash", loc.T("flash.logged_in"))
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// UserLogoutPost logs the current user out.
+func UserLogoutPost(app *config.Application, helpers *middleware.Helpers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loc := helpers.Localizer(r)
+
+		userID := helpers.AuthenticatedUserID(r)
+		if userID > 0 {
+			recordAudit(app, helpers.AuditEvent(r, models.AuditLogout, audit.User(userID)))
+		}
+
+		err := app.SessionManager.RenewToken(r.Context())
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		app.SessionManager.Remove(r.Context(), "authenticatedUserID")
+		app.SessionManager.Remove(r.Context(), "csrfToken")
+		app.SessionManager.Put(r.Context(), "flash", loc.T("flash.logged_out"))
+
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	}
+}
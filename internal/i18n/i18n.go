@@ -0,0 +1,327 @@
+package i18n
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	// Embed the time zone database so that visitors can pick any zone, even
+	// on hosts without zoneinfo files.
+	_ "time/tzdata"
+
+	"github.com/Hiwiii/snippetbox.git/internal/negotiate"
+)
+
+// DefaultDateLayout is the humanDate layout of catalogs which don't set one.
+// It ends with the abbreviation of the time zone, so that readers know which
+// zone the time is in.
+const DefaultDateLayout = "02 Jan 2006 at 15:04 MST"
+
+// The errors returned by Load.
+var (
+	ErrNoCatalogs     = errors.New("i18n: no message catalogs")
+	ErrNoDefault      = errors.New("i18n: no catalog for the default locale")
+	ErrInvalidMessage = errors.New("i18n: invalid message")
+)
+
+// ErrInvalidZone is returned by LoadZone for names which aren't time zones.
+var ErrInvalidZone = errors.New("i18n: invalid time zone")
+
+// Message is a translated string. Messages which include a count have a form
+// for each CLDR plural category the language uses ("zero", "one", "two",
+// "few", "many" and "other"); the others only have Other.
+type Message struct {
+	Other string
+	Forms map[string]string
+}
+
+// UnmarshalJSON accepts either a string or an object of plural forms, which
+// must include "other".
+func (m *Message) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &m.Other); err == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(b, &m.Forms); err != nil {
+		return err
+	}
+	other, ok := m.Forms["other"]
+	if !ok {
+		return fmt.Errorf("%w: plural forms without \"other\"", ErrInvalidMessage)
+	}
+	m.Other = other
+	return nil
+}
+
+// Catalog is the translation of the user interface into one language, read
+// from a JSON file named after its language tag, such as "de.json".
+type Catalog struct {
+	Tag  string `json:"-"`
+	Name string `json:"name"` // name of the language in itself, e.g. "Deutsch"
+	// DateLayout is the time layout used by humanDate. "Jan" in the layout is
+	// replaced by the month from Months, if they are set.
+	DateLayout string             `json:"date_layout"`
+	Months     []string           `json:"months"`
+	Messages   map[string]Message `json:"messages"`
+}
+
+// Bundle holds the catalogs of every supported locale.
+type Bundle struct {
+	Default  string // tag of the locale used when none of the others fit
+	catalogs map[string]*Catalog
+	tags     []string // default first, then alphabetical
+}
+
+// Load reads the catalogs in the top directory of fsys. defaultTag is the
+// locale used for visitors who accept none of them, and fills in messages
+// missing from the other catalogs.
+func Load(fsys fs.FS, defaultTag string) (*Bundle, error) {
+	files, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, ErrNoCatalogs
+	}
+
+	b := &Bundle{Default: defaultTag, catalogs: make(map[string]*Catalog)}
+
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		c := &Catalog{Tag: strings.TrimSuffix(path.Base(file), ".json")}
+		if err := json.Unmarshal(data, c); err != nil {
+			return nil, fmt.Errorf("i18n: %s: %w", file, err)
+		}
+		if c.Months != nil && len(c.Months) != 12 {
+			return nil, fmt.Errorf("i18n: %s: %d months instead of 12", file, len(c.Months))
+		}
+		if c.DateLayout == "" {
+			c.DateLayout = DefaultDateLayout
+		}
+
+		b.catalogs[c.Tag] = c
+		b.tags = append(b.tags, c.Tag)
+	}
+
+	if _, ok := b.catalogs[defaultTag]; !ok {
+		return nil, fmt.Errorf("%w %q", ErrNoDefault, defaultTag)
+	}
+	sort.Slice(b.tags, func(i, j int) bool {
+		if b.tags[i] == defaultTag || b.tags[j] == defaultTag {
+			return b.tags[i] == defaultTag
+		}
+		return b.tags[i] < b.tags[j]
+	})
+
+	return b, nil
+}
+
+// Catalogs returns the catalogs of every locale, default first.
+func (b *Bundle) Catalogs() []*Catalog {
+	catalogs := make([]*Catalog, len(b.tags))
+	for i, tag := range b.tags {
+		catalogs[i] = b.catalogs[tag]
+	}
+	return catalogs
+}
+
+// Supported reports whether tag is one of the bundle's locales.
+func (b *Bundle) Supported(tag string) bool {
+	_, ok := b.catalogs[tag]
+	return ok
+}
+
+// Match returns the locale an Accept-Language header prefers, or the default
+// locale if it accepts none of them.
+func (b *Bundle) Match(acceptLanguage string) string {
+	if tag := negotiate.Language(acceptLanguage, b.tags...); tag != "" {
+		return tag
+	}
+	return b.Default
+}
+
+// Localizer returns a Localizer for tag, or for the default locale if tag
+// isn't supported.
+func (b *Bundle) Localizer(tag string) *Localizer {
+	c, ok := b.catalogs[tag]
+	if !ok {
+		c = b.catalogs[b.Default]
+	}
+	return &Localizer{catalog: c, fallback: b.catalogs[b.Default]}
+}
+
+// Localizer translates messages and formats dates for one locale, in one
+// time zone. A nil Localizer returns message keys unchanged and formats dates
+// in English, which is what tests and pages without a locale get.
+type Localizer struct {
+	catalog  *Catalog
+	fallback *Catalog
+	zone     *time.Location // nil for UTC
+}
+
+// In returns a copy of l which shows dates in zone. l must not be nil.
+func (l *Localizer) In(zone *time.Location) *Localizer {
+	c := *l
+	c.zone = zone
+	return &c
+}
+
+// Zone returns the time zone dates are shown in.
+func (l *Localizer) Zone() *time.Location {
+	if l == nil || l.zone == nil {
+		return time.UTC
+	}
+	return l.zone
+}
+
+// Tag returns the language tag of the locale, or "" for a nil Localizer.
+func (l *Localizer) Tag() string {
+	if l == nil {
+		return ""
+	}
+	return l.catalog.Tag
+}
+
+// T returns the message for key, formatted with args as by fmt.Sprintf.
+// Messages with plural forms take the count as their first argument; a form
+// without any verbs is returned as it is. Keys missing from the catalog fall
+// back to the default locale, and then to the key itself, so that
+// untranslated text is easy to spot.
+func (l *Localizer) T(key string, args ...any) string {
+	msg, ok := l.lookup(key)
+	if !ok {
+		return key
+	}
+
+	text := msg.Other
+	if msg.Forms != nil && len(args) > 0 {
+		if n, ok := count(args[0]); ok {
+			if form, ok := msg.Forms[PluralCategory(l.Tag(), n)]; ok {
+				text = form
+			}
+		}
+	}
+
+	// Plural forms such as "It will be deleted." may not use the count.
+	if len(args) == 0 || !strings.Contains(text, "%") {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// lookup finds the message for key in the catalog or the fallback.
+func (l *Localizer) lookup(key string) (Message, bool) {
+	if l == nil {
+		return Message{}, false
+	}
+	for _, c := range []*Catalog{l.catalog, l.fallback} {
+		if msg, ok := c.Messages[key]; ok {
+			return msg, true
+		}
+	}
+	return Message{}, false
+}
+
+// Date formats t in the Localizer's time zone, with the locale's date layout
+// and month names.
+func (l *Localizer) Date(t time.Time) string {
+	t = t.In(l.Zone())
+	if l == nil {
+		return t.Format(DefaultDateLayout)
+	}
+	if l.catalog.Months == nil {
+		return t.Format(l.catalog.DateLayout)
+	}
+
+	// Format the text around each "Jan" separately, so that the month name
+	// can't be mistaken for part of the layout.
+	parts := strings.Split(l.catalog.DateLayout, "Jan")
+	for i, part := range parts {
+		parts[i] = t.Format(part)
+	}
+	return strings.Join(parts, l.catalog.Months[t.Month()-1])
+}
+
+// Relative describes when t is compared to now, such as "3 hours ago" or "in
+// 2 days". The difference is rounded down to the largest unit that fits, and
+// anything under a minute is "just now".
+func (l *Localizer) Relative(t, now time.Time) string {
+	const day = 24 * time.Hour
+
+	d, key := t.Sub(now), "time.in."
+	if t.Before(now) {
+		d, key = now.Sub(t), "time.ago."
+	}
+
+	var unit string
+	var n time.Duration
+	switch {
+	case d < time.Minute:
+		return l.T("time.now")
+	case d < time.Hour:
+		unit, n = "minute", d/time.Minute
+	case d < day:
+		unit, n = "hour", d/time.Hour
+	case d < 7*day:
+		unit, n = "day", d/day
+	case d < 30*day:
+		unit, n = "week", d/(7*day)
+	case d < 365*day:
+		unit, n = "month", d/(30*day)
+	default:
+		unit, n = "year", d/(365*day)
+	}
+	return l.T(key+unit, int(n))
+}
+
+// zones caches the locations returned by LoadZone, since time.LoadLocation
+// reads the zone database on every call.
+var zones sync.Map
+
+// LoadZone returns the time zone with the given IANA name, such as
+// "Europe/Berlin". Unlike time.LoadLocation it doesn't accept "" or "Local",
+// which aren't names a visitor could mean.
+func LoadZone(name string) (*time.Location, error) {
+	if zone, ok := zones.Load(name); ok {
+		return zone.(*time.Location), nil
+	}
+	if name == "" || name == "Local" {
+		return nil, ErrInvalidZone
+	}
+
+	zone, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q", ErrInvalidZone, name)
+	}
+	zones.Store(name, zone)
+	return zone, nil
+}
+
+// count returns the value of an integer argument.
+func count(arg any) (int, bool) {
+	switch n := arg.(type) {
+	case int:
+		return n, true
+	case int32:
+		return int(n), true
+	case int64:
+		return int(n), true
+	case uint:
+		return int(n), true
+	case uint32:
+		return int(n), true
+	case uint64:
+		return int(n), true
+	}
+	return 0, false
+}
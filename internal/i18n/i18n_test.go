@@ -0,0 +1,295 @@
+package i18n
+
+import (
+	"errors"
+	"io/fs"
+	"regexp"
+	"slices"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/Hiwiii/snippetbox.git/internal/validators"
+	"github.com/Hiwiii/snippetbox.git/ui"
+)
+
+var testCatalogs = fstest.MapFS{
+	"en.json": {Data: []byte(`{
+		"name": "English",
+		"messages": {
+			"hello": "Hello, %s",
+			"percent": "100%",
+			"files": {"one": "%d file", "other": "%d files"},
+			"deleted": {"one": "It will be deleted.", "other": "%d views left."},
+			"only.en": "English only",
+			"time.now": "just now",
+			"time.ago.hour": {"one": "%d hour ago", "other": "%d hours ago"},
+			"time.in.day": {"one": "in %d day", "other": "in %d days"},
+			"time.in.month": {"one": "in %d month", "other": "in %d months"}
+		}
+	}`)},
+	"de.json": {Data: []byte(`{
+		"name": "Deutsch",
+		"date_layout": "02. Jan 2006 um 15:04",
+		"months": ["Jan.", "Feb.", "März", "Apr.", "Mai", "Juni", "Juli", "Aug.", "Sept.", "Okt.", "Nov.", "Dez."],
+		"messages": {
+			"hello": "Hallo, %s",
+			"files": {"one": "%d Datei", "other": "%d Dateien"}
+		}
+	}`)},
+	"fr.json": {Data: []byte(`{
+		"name": "Français",
+		"messages": {
+			"files": {"one": "%d fichier", "other": "%d fichiers"}
+		}
+	}`)},
+}
+
+func TestLoad(t *testing.T) {
+	b, err := Load(testCatalogs, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tags []string
+	for _, c := range b.Catalogs() {
+		tags = append(tags, c.Tag)
+	}
+	if want := []string{"en", "de", "fr"}; !slices.Equal(tags, want) {
+		t.Errorf("got catalogs %v; want %v", tags, want)
+	}
+
+	tests := []struct {
+		name    string
+		fsys    fstest.MapFS
+		want    error
+		wantAny bool
+	}{
+		{"No catalogs", fstest.MapFS{}, ErrNoCatalogs, false},
+		{"No default", fstest.MapFS{"de.json": {Data: []byte(`{}`)}}, ErrNoDefault, false},
+		{"Plural without other", fstest.MapFS{"en.json": {Data: []byte(`{"messages": {"x": {"one": "x"}}}`)}}, ErrInvalidMessage, false},
+		{"Wrong number of months", fstest.MapFS{"en.json": {Data: []byte(`{"months": ["Jan"]}`)}}, nil, true},
+		{"Invalid JSON", fstest.MapFS{"en.json": {Data: []byte(`{`)}}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(tt.fsys, "en")
+			if tt.wantAny {
+				if err == nil {
+					t.Error("got no error")
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got error %v; want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestT(t *testing.T) {
+	b, err := Load(testCatalogs, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		tag  string
+		key  string
+		args []any
+		want string
+	}{
+		{"en", "hello", []any{"Gopher"}, "Hello, Gopher"},
+		{"de", "hello", []any{"Gopher"}, "Hallo, Gopher"},
+		{"en", "percent", nil, "100%"},
+		{"en", "files", []any{1}, "1 file"},
+		{"en", "files", []any{0}, "0 files"},
+		{"de", "files", []any{int32(1)}, "1 Datei"},
+		{"de", "files", []any{int64(3)}, "3 Dateien"},
+		{"en", "deleted", []any{1}, "It will be deleted."},
+		{"en", "deleted", []any{2}, "2 views left."},
+		{"de", "only.en", nil, "English only"},
+		{"de", "missing.key", nil, "missing.key"},
+		{"it", "hello", []any{"Gopher"}, "Hello, Gopher"},
+	}
+
+	for _, tt := range tests {
+		if got := b.Localizer(tt.tag).T(tt.key, tt.args...); got != tt.want {
+			t.Errorf("%s: T(%q, %v) = %q; want %q", tt.tag, tt.key, tt.args, got, tt.want)
+		}
+	}
+
+	var nilLocalizer *Localizer
+	if got := nilLocalizer.T("hello"); got != "hello" {
+		t.Errorf("nil Localizer: got %q; want %q", got, "hello")
+	}
+}
+
+func TestDate(t *testing.T) {
+	b, err := Load(testCatalogs, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	berlin, err := LoadZone("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date := time.Date(2024, 3, 1, 9, 5, 0, 0, time.UTC)
+	tests := []struct {
+		l    *Localizer
+		want string
+	}{
+		{b.Localizer("en"), "01 Mar 2024 at 09:05 UTC"},
+		{b.Localizer("en").In(berlin), "01 Mar 2024 at 10:05 CET"},
+		{b.Localizer("de"), "01. März 2024 um 09:05"},
+		{b.Localizer("de").In(berlin), "01. März 2024 um 10:05"},
+		{nil, "01 Mar 2024 at 09:05 UTC"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.l.Date(date); got != tt.want {
+			t.Errorf("%s: got %q; want %q", tt.l.Tag(), got, tt.want)
+		}
+	}
+}
+
+func TestRelative(t *testing.T) {
+	b, err := Load(testCatalogs, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	en := b.Localizer("en")
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "just now"},
+		{-59 * time.Second, "just now"},
+		{-time.Hour, "1 hour ago"},
+		{-5*time.Hour - 59*time.Minute, "5 hours ago"},
+		{24 * time.Hour, "in 1 day"},
+		{49 * time.Hour, "in 2 days"},
+		{90 * 24 * time.Hour, "in 3 months"},
+	}
+
+	for _, tt := range tests {
+		if got := en.Relative(now.Add(tt.d), now); got != tt.want {
+			t.Errorf("Relative(now + %v) = %q; want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestLoadZone(t *testing.T) {
+	zone, err := LoadZone("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zone.String() != "America/New_York" {
+		t.Errorf("got zone %s; want America/New_York", zone)
+	}
+
+	for _, name := range []string{"", "Local", "Mars/Olympus_Mons", "../etc/passwd"} {
+		if _, err := LoadZone(name); !errors.Is(err, ErrInvalidZone) {
+			t.Errorf("LoadZone(%q): got error %v; want %v", name, err, ErrInvalidZone)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	b, err := Load(testCatalogs, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", "en"},
+		{"de-DE,de;q=0.9,en;q=0.8", "de"},
+		{"fr-CH, fr;q=0.9", "fr"},
+		{"it", "en"},
+		{"it, de;q=0.5", "de"},
+	}
+
+	for _, tt := range tests {
+		if got := b.Match(tt.header); got != tt.want {
+			t.Errorf("Match(%q) = %q; want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestPluralCategory(t *testing.T) {
+	tests := []struct {
+		tag  string
+		n    int
+		want string
+	}{
+		{"en", 1, "one"},
+		{"en", -1, "one"},
+		{"en", 0, "other"},
+		{"en", 11, "other"},
+		{"en", 21, "other"},
+		{"en-GB", 2, "other"},
+		{"de", 1, "one"},
+		{"de", 0, "other"},
+		{"de", 101, "other"},
+		{"de-AT", 3, "other"},
+	}
+
+	for _, tt := range tests {
+		if got := PluralCategory(tt.tag, tt.n); got != tt.want {
+			t.Errorf("PluralCategory(%q, %d) = %q; want %q", tt.tag, tt.n, got, tt.want)
+		}
+	}
+}
+
+// verbRX matches the fmt verbs in a message.
+var verbRX = regexp.MustCompile(`%[-+# 0]*[0-9]*(\.[0-9]+)?[a-zA-Z%]`)
+
+func TestEmbeddedCatalogs(t *testing.T) {
+	locales, err := fs.Sub(ui.Files, "locales")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Load(locales, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	catalogs := b.Catalogs()
+	def := catalogs[0]
+
+	// Fields which fail a rule in their validate tag get its message.
+	for _, rule := range validator.Rules() {
+		if _, ok := def.Messages["validation."+rule]; !ok {
+			t.Errorf("%s: message for the validation rule %q is missing", def.Tag, rule)
+		}
+	}
+
+	// Every catalog translates every message of the default one, with the
+	// same verbs so that the arguments line up.
+	for _, c := range catalogs[1:] {
+		for key, msg := range def.Messages {
+			translated, ok := c.Messages[key]
+			if !ok {
+				t.Errorf("%s: message %q is missing", c.Tag, key)
+				continue
+			}
+			want := verbRX.FindAllString(msg.Other, -1)
+			if got := verbRX.FindAllString(translated.Other, -1); !slices.Equal(got, want) {
+				t.Errorf("%s: message %q has verbs %v; want %v", c.Tag, key, got, want)
+			}
+		}
+		for key := range c.Messages {
+			if _, ok := def.Messages[key]; !ok {
+				t.Errorf("%s: message %q isn't in the %s catalog", c.Tag, key, def.Tag)
+			}
+		}
+	}
+}
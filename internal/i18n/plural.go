@@ -0,0 +1,12 @@
+package i18n
+
+// PluralCategory returns the CLDR plural category of the integer n in the
+// language of tag. Only the rule of the languages in ui/locales, English and
+// German, is implemented: "one" for 1 and "other" for everything else. Adding
+// a catalog for a language with other rules means adding them here.
+func PluralCategory(tag string, n int) string {
+	if n == 1 || n == -1 {
+		return "one"
+	}
+	return "other"
+}
@@ -0,0 +1,179 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Message is an email with a plain-text body and an HTML alternative.
+type Message struct {
+	To       string
+	Subject  string
+	TextBody string
+	HTMLBody string
+}
+
+// Mailer sends email messages.
+type Mailer interface {
+	Send(msg *Message) error
+}
+
+// NewMessage renders the email template file in fsys for the recipient. The
+// file must define three templates: "subject" and "plainBody", which are
+// rendered as plain text, and "htmlBody", which is rendered with html/template
+// so the data is escaped.
+func NewMessage(fsys fs.FS, file, to string, data any) (*Message, error) {
+	tmpl, err := template.New(file).ParseFS(fsys, file)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(subject, "subject", data)
+	if err != nil {
+		return nil, err
+	}
+
+	textBody := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(textBody, "plainBody", data)
+	if err != nil {
+		return nil, err
+	}
+
+	htmlTmpl, err := htmltemplate.New(file).ParseFS(fsys, file)
+	if err != nil {
+		return nil, err
+	}
+
+	htmlBody := new(bytes.Buffer)
+	err = htmlTmpl.ExecuteTemplate(htmlBody, "htmlBody", data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		To:       to,
+		Subject:  strings.TrimSpace(subject.String()),
+		TextBody: textBody.String(),
+		HTMLBody: htmlBody.String(),
+	}, nil
+}
+
+// SMTPMailer sends messages through an SMTP server.
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	Sender   string
+}
+
+// Send delivers the message to the SMTP server, authenticating if a username
+// has been configured.
+func (m *SMTPMailer) Send(msg *Message) error {
+	body, err := encode(m.Sender, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	// The envelope sender is the bare address from the Sender header.
+	from, err := mail.ParseAddress(m.Sender)
+	if err != nil {
+		return err
+	}
+
+	addr := fmt.Sprintf("%s:%d", m.Host, m.Port)
+
+	return smtp.SendMail(addr, auth, from.Address, []string{msg.To}, body)
+}
+
+// LogMailer writes every message in full, including headers, to a writer
+// instead of sending it. It is used in development and tests.
+type LogMailer struct {
+	mu     sync.Mutex
+	Writer io.Writer
+	Sender string
+}
+
+// Send writes the encoded message to the writer.
+func (m *LogMailer) Send(msg *Message) error {
+	body, err := encode(m.Sender, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err = fmt.Fprintf(m.Writer, "%s\n", body)
+	return err
+}
+
+// encode builds a multipart/alternative MIME message with quoted-printable
+// plain-text and HTML parts.
+func encode(sender string, msg *Message, date time.Time) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	mw := multipart.NewWriter(buf)
+
+	headers := new(bytes.Buffer)
+	fmt.Fprintf(headers, "From: %s\r\n", sender)
+	fmt.Fprintf(headers, "To: %s\r\n", msg.To)
+	fmt.Fprintf(headers, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(headers, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(headers, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(headers, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", mw.Boundary())
+
+	// Clients show the last alternative they understand, so HTML goes last.
+	parts := []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=utf-8", msg.TextBody},
+		{"text/html; charset=utf-8", msg.HTMLBody},
+	}
+
+	for _, part := range parts {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		qw := quotedprintable.NewWriter(pw)
+		_, err = qw.Write([]byte(part.body))
+		if err != nil {
+			return nil, err
+		}
+		err = qw.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := mw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(headers.Bytes(), buf.Bytes()...), nil
+}
@@ -0,0 +1,68 @@
+package mailer
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncode(t *testing.T) {
+	msg := &Message{
+		To:       "a@example.com",
+		Subject:  "Snippet \"café\"\r\nBcc: evil@example.com",
+		TextBody: "plain",
+		HTMLBody: "<p>html</p>",
+	}
+
+	raw, err := encode("Snippetbox <no-reply@example.com>", msg, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bcc := parsed.Header.Get("Bcc"); bcc != "" {
+		t.Errorf("subject injected a Bcc header: %q", bcc)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q; want multipart/alternative", mediaType)
+	}
+
+	mr := multipart.NewReader(parsed.Body, params["boundary"])
+	var types, bodies []string
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, part.Header.Get("Content-Type"))
+		bodies = append(bodies, string(body))
+	}
+
+	if len(types) != 2 || !strings.HasPrefix(types[0], "text/plain") || !strings.HasPrefix(types[1], "text/html") {
+		t.Fatalf("part types = %v; want text/plain then text/html", types)
+	}
+	if bodies[0] != "plain" || bodies[1] != "<p>html</p>" {
+		t.Errorf("bodies = %q", bodies)
+	}
+}
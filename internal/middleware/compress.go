@@ -0,0 +1,297 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/Hiwiii/snippetbox.git/internal/negotiate"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// minCompressSize is the smallest body worth compressing. Smaller bodies
+// often grow once the encoding's framing is added.
+const minCompressSize = 1024
+
+// encodings lists the supported content codings in order of preference.
+var encodings = []string{"br", "zstd", "gzip"}
+
+// encoder is a compressor that can be reused for another response.
+type encoder interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+// zstdEncoder adapts *zstd.Encoder, whose Reset doesn't match the interface.
+type zstdEncoder struct{ *zstd.Encoder }
+
+func (e zstdEncoder) Reset(w io.Writer) { e.Encoder.Reset(w) }
+
+// encoderPools hold idle compressors for each encoding, since creating one
+// allocates large buffers. The levels favour speed, since pages are
+// compressed on every request.
+var encoderPools = map[string]*sync.Pool{
+	"br": {New: func() any {
+		return brotli.NewWriterLevel(nil, 4)
+	}},
+	"zstd": {New: func() any {
+		enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault), zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			panic(err)
+		}
+		return zstdEncoder{enc}
+	}},
+	"gzip": {New: func() any {
+		gw, err := gzip.NewWriterLevel(nil, 5)
+		if err != nil {
+			panic(err)
+		}
+		return gw
+	}},
+}
+
+// compressibleType reports whether responses of a media type are worth
+// compressing. Images, archives and the like are already compressed.
+func compressibleType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case strings.HasSuffix(mediaType, "+json"), strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+
+	switch mediaType {
+	case "application/json", "application/javascript", "application/xml",
+		"application/x-ndjson", "image/svg+xml", "application/wasm":
+		return true
+	}
+	return false
+}
+
+// Compress compresses responses with brotli, zstd or gzip, whichever the
+// client prefers. Bodies smaller than minCompressSize, responses which are
+// already encoded, partial content and types that don't compress well are
+// sent as they are. So are responses marked Cache-Control: no-store, which
+// handlers use for pages with secrets on them: compressing a secret together
+// with reflected input lets an attacker guess it from the size of the
+// response (BREACH).
+func Compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{
+			ResponseWriter: w,
+			encoding:       negotiate.Encoding(r.Header.Get("Accept-Encoding"), encodings...),
+		}
+		defer cw.close()
+
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressWriter holds back the status code and the start of the body until
+// it knows whether to compress: once minCompressSize bytes have been written,
+// or when the handler returns or flushes.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string // negotiated encoding, or "" if the client accepts none
+
+	status  int
+	buf     []byte
+	decided bool
+	enc     encoder // nil if the response isn't compressed
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.decided || cw.status != 0 {
+		// Pass through so that net/http can report superfluous calls.
+		if cw.decided {
+			cw.ResponseWriter.WriteHeader(status)
+		}
+		return
+	}
+
+	// Informational responses, such as 103 Early Hints, go straight out.
+	if status >= 100 && status < 200 {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	cw.status = status
+
+	// Responses without a body can be decided straight away.
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		cw.decide()
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < minCompressSize {
+			return len(p), nil
+		}
+		cw.decide()
+		if err := cw.writeBuffered(); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	if cw.enc != nil {
+		return cw.enc.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// decide picks whether to compress, based on the headers and the buffered
+// start of the body, and sends the status line and headers.
+func (cw *compressWriter) decide() {
+	cw.decided = true
+	h := cw.Header()
+
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	// Set the type now, since net/http would otherwise sniff it from the
+	// compressed bytes.
+	if _, ok := h["Content-Type"]; !ok && len(cw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+
+	ok := cw.status != http.StatusNoContent &&
+		cw.status != http.StatusPartialContent &&
+		cw.status != http.StatusNotModified &&
+		h.Get("Content-Encoding") == "" &&
+		h.Get("Content-Range") == "" &&
+		!noStore(h) &&
+		compressibleType(h.Get("Content-Type"))
+
+	// The response depends on Accept-Encoding whether or not this one is
+	// compressed.
+	if ok && !varies(h, "Accept-Encoding") {
+		h.Add("Vary", "Accept-Encoding")
+	}
+
+	if ok && cw.encoding != "" && len(cw.buf) >= minCompressSize {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		// A strong ETag names the uncompressed bytes.
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+
+		cw.enc = encoderPools[cw.encoding].Get().(encoder)
+		cw.enc.Reset(cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+}
+
+// varies reports whether the Vary header already names field.
+func varies(h http.Header, field string) bool {
+	for _, v := range h.Values("Vary") {
+		for _, f := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(f), field) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// noStore reports whether the Cache-Control header has the no-store directive.
+func noStore(h http.Header) bool {
+	for _, v := range h.Values("Cache-Control") {
+		for _, d := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(d), "no-store") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeBuffered writes out the body held back before the decision.
+func (cw *compressWriter) writeBuffered() error {
+	if len(cw.buf) == 0 {
+		return nil
+	}
+
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(cw.buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf)
+	}
+	cw.buf = nil
+	return err
+}
+
+// close finishes the response once the handler has returned.
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		// Nothing written means the handler left net/http to send the
+		// default 200 with an empty body.
+		if cw.status == 0 && len(cw.buf) == 0 {
+			return
+		}
+		cw.decide()
+		cw.writeBuffered()
+	}
+
+	if cw.enc != nil {
+		cw.enc.Close()
+		cw.enc.Reset(nil)
+		encoderPools[cw.encoding].Put(cw.enc)
+		cw.enc = nil
+	}
+}
+
+// Flush sends what has been written so far, deciding on compression early
+// if necessary.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.decide()
+		cw.writeBuffered()
+	}
+
+	if f, ok := cw.enc.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets handlers take over the connection, which is only possible
+// before anything has been written.
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	cw.decided = true
+	return http.NewResponseController(cw.ResponseWriter).Hijack()
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
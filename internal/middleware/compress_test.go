@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+var page = strings.Repeat("<p>Snippetbox</p>\n", 200)
+
+func serve(t *testing.T, h http.Handler, method, acceptEncoding string) *http.Response {
+	t.Helper()
+	r := httptest.NewRequest(method, "/", nil)
+	if acceptEncoding != "" {
+		r.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	rr := httptest.NewRecorder()
+	Compress(h).ServeHTTP(rr, r)
+	return rr.Result()
+}
+
+func decode(t *testing.T, res *http.Response) string {
+	t.Helper()
+	var r io.Reader = res.Body
+	switch res.Header.Get("Content-Encoding") {
+	case "gzip":
+		gr, err := gzip.NewReader(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = gr
+	case "br":
+		r = brotli.NewReader(res.Body)
+	case "zstd":
+		zr, err := zstd.NewReader(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// renderLike writes the status before the body, as Helpers.Render does.
+func renderLike(status int, body string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	})
+}
+
+func TestCompressEncodings(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"gzip", "gzip"},
+		{"gzip, br", "br"},
+		{"zstd, gzip", "zstd"},
+		{"br;q=0.5, gzip", "gzip"},
+		{"identity", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			res := serve(t, renderLike(http.StatusUnprocessableEntity, page), http.MethodGet, tt.accept)
+
+			if res.StatusCode != http.StatusUnprocessableEntity {
+				t.Errorf("got status %d; want %d", res.StatusCode, http.StatusUnprocessableEntity)
+			}
+			if got := res.Header.Get("Content-Encoding"); got != tt.want {
+				t.Errorf("got Content-Encoding %q; want %q", got, tt.want)
+			}
+			if got := res.Header.Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("got Vary %q; want %q", got, "Accept-Encoding")
+			}
+			if got := decode(t, res); got != page {
+				t.Errorf("body doesn't match after decoding")
+			}
+		})
+	}
+}
+
+func TestCompressSkips(t *testing.T) {
+	precompressed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/css; charset=utf-8")
+		w.Header().Set("Content-Encoding", "br")
+		io.WriteString(w, page)
+	})
+	image := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 2048)...))
+	})
+	secret := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Cache-Control", "private, No-Store")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, page)
+	})
+	partial := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Range", "bytes 0-3599/7200")
+		w.WriteHeader(http.StatusPartialContent)
+		io.WriteString(w, page)
+	})
+
+	tests := []struct {
+		name     string
+		handler  http.Handler
+		method   string
+		wantEnc  string
+		wantType string
+	}{
+		{"Small body", renderLike(http.StatusOK, "<p>Hello</p>"), http.MethodGet, "", "text/html; charset=utf-8"},
+		{"Already encoded", precompressed, http.MethodGet, "br", "text/css; charset=utf-8"},
+		{"Image", image, http.MethodGet, "", "image/png"},
+		{"Partial content", partial, http.MethodGet, "", "text/plain"},
+		{"No-store", secret, http.MethodGet, "", "text/html; charset=utf-8"},
+		{"HEAD", renderLike(http.StatusOK, page), http.MethodHead, "", "text/html; charset=utf-8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := serve(t, tt.handler, tt.method, "gzip, br, zstd")
+
+			if got := res.Header.Get("Content-Encoding"); got != tt.wantEnc {
+				t.Errorf("got Content-Encoding %q; want %q", got, tt.wantEnc)
+			}
+			if got := res.Header.Get("Content-Type"); got != tt.wantType {
+				t.Errorf("got Content-Type %q; want %q", got, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestCompressFlush(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "first\n")
+		http.NewResponseController(w).Flush()
+		io.WriteString(w, page)
+	})
+
+	res := serve(t, h, http.MethodGet, "gzip")
+
+	// Flushing decides on compression while the body is still too small, so
+	// the rest of the response is sent as it is.
+	if got := res.Header.Get("Content-Encoding"); got != "" {
+		t.Errorf("got Content-Encoding %q; want none", got)
+	}
+	if got := decode(t, res); got != "first\n"+page {
+		t.Errorf("body doesn't match after decoding")
+	}
+}
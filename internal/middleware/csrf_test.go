@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/alexedwards/scs/v2"
+)
+
+func TestVerifyCSRF(t *testing.T) {
+	helpers := &Helpers{SessionManager: scs.New()}
+
+	// /token stands in for Authenticate, giving the session a token and
+	// showing it like a form would.
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		err := helpers.ensureCSRFToken(r)
+		if err != nil {
+			t.Error(err)
+		}
+		io.WriteString(w, helpers.SessionManager.GetString(r.Context(), "csrfToken"))
+	})
+	mux.Handle("/protected", VerifyCSRF(helpers)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "OK")
+	})))
+
+	ts := httptest.NewServer(helpers.SessionManager.LoadAndSave(mux))
+	defer ts.Close()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Jar: jar}
+
+	get := func(path string) string {
+		res, err := client.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		b, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	post := func(form url.Values) int {
+		res, err := client.PostForm(ts.URL+"/protected", form)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	// A session without a token can't post, even with an empty field.
+	if code := post(url.Values{"csrf_token": {""}}); code != http.StatusForbidden {
+		t.Errorf("no session token: got status %d; want %d", code, http.StatusForbidden)
+	}
+
+	token := get("/token")
+	if token == "" {
+		t.Fatal("no token was created")
+	}
+	if again := get("/token"); again != token {
+		t.Errorf("token changed from %q to %q", token, again)
+	}
+
+	tests := []struct {
+		name string
+		form url.Values
+		want int
+	}{
+		{"Valid token", url.Values{"csrf_token": {token}}, http.StatusOK},
+		{"Missing token", url.Values{}, http.StatusForbidden},
+		{"Wrong token", url.Values{"csrf_token": {token[1:] + "x"}}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := post(tt.form); code != tt.want {
+				t.Errorf("got status %d; want %d", code, tt.want)
+			}
+		})
+	}
+
+	if body := get("/protected"); body != "OK" {
+		t.Errorf("GET: got %q; want %q", body, "OK")
+	}
+}
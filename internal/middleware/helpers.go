@@ -4,12 +4,14 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
-	"html/template"
 	"log"
+	"net"
 	"net/http"
 	"runtime/debug"
 	"time"
 
+	"github.com/Hiwiii/snippetbox.git/internal/i18n"
+	"github.com/Hiwiii/snippetbox.git/internal/models"
 	"github.com/Hiwiii/snippetbox.git/internal/templates"
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
@@ -17,9 +19,14 @@ import (
 
 type Helpers struct {
 	ErrorLog       *log.Logger
-	TemplateCache  map[string]*template.Template
+	TemplateCache  templates.LocaleCache
 	FormDecoder    *form.Decoder
 	SessionManager *scs.SessionManager
+	LoginEnabled   bool         // true if single sign-on is configured
+	I18n           *i18n.Bundle // message catalogs of the supported locales
+	// TemplateReloader is only set in development mode. It replaces
+	// TemplateCache with templates that are re-parsed when they change.
+	TemplateReloader *templates.Reloader
 }
 
 // serverError writes an error message and stack trace to the error log,
@@ -47,11 +54,25 @@ func (h *Helpers) NotFound(w http.ResponseWriter) {
 	h.ClientError(w, http.StatusNotFound)
 }
 
-// Render retrieves the appropriate template from the cache and renders it.
-// Render retrieves the appropriate template from the cache and renders it.
-func (h *Helpers) Render(w http.ResponseWriter, status int, page string, data interface{}) {
+// Render retrieves the appropriate template from the cache and renders it in
+// the locale of the request. Dates are shown in the time zone NewTemplateData
+// puts in the data. In development mode, template errors are shown in the
+// browser.
+func (h *Helpers) Render(w http.ResponseWriter, r *http.Request, status int, page string, data interface{}) {
+	cache := h.TemplateCache
+	if h.TemplateReloader != nil {
+		var err error
+		cache, err = h.TemplateReloader.Cache()
+		if err != nil {
+			h.ErrorLog.Output(2, err.Error())
+			h.TemplateReloader.WriteError(w, err)
+			return
+		}
+	}
+
 	// Retrieve the appropriate template set from the cache.
-	ts, ok := h.TemplateCache[page]
+	loc := h.Localizer(r)
+	ts, ok := cache[loc.Tag()][page]
 	if !ok {
 		err := fmt.Errorf("the template %s does not exist", page)
 		h.ServerError(w, err)
@@ -64,6 +85,11 @@ func (h *Helpers) Render(w http.ResponseWriter, status int, page string, data in
 	// Write the template to the buffer instead of the ResponseWriter.
 	err := ts.ExecuteTemplate(buf, "base", data)
 	if err != nil {
+		if h.TemplateReloader != nil {
+			h.ErrorLog.Output(2, err.Error())
+			h.TemplateReloader.WriteError(w, err)
+			return
+		}
 		h.ServerError(w, err)
 		return
 	}
@@ -81,9 +107,29 @@ func (h *Helpers) Render(w http.ResponseWriter, status int, page string, data in
 // NewTemplateData initializes and returns a TemplateData struct.
 func (h *Helpers) NewTemplateData(r *http.Request) *templates.TemplateData {
 	return &templates.TemplateData{
-		CurrentYear: time.Now().Year(),
-		Flash:       h.SessionManager.PopString(r.Context(), "flash"),
+		CurrentYear:     time.Now().Year(),
+		Flash:           h.SessionManager.PopString(r.Context(), "flash"),
+		IsAuthenticated: h.IsAuthenticated(r),
+		CurrentUser:     h.AuthenticatedUser(r),
+		CSRFToken:       h.SessionManager.GetString(r.Context(), "csrfToken"),
+		LoginEnabled:    h.LoginEnabled,
+		Locale:          h.Localizer(r).Tag(),
+		LocaleChosen:    h.SessionManager.Exists(r.Context(), "locale"),
+		Locales:         h.I18n.Catalogs(),
+		CurrentPath:     r.URL.RequestURI(),
+		Timezone:        h.Localizer(r).Zone().String(),
+		Zone:            h.Localizer(r).Zone(),
+		TimezoneChosen:  h.SessionManager.Exists(r.Context(), "timezone"),
+	}
+}
+
+// Localizer returns the Localizer for the locale picked by the Localize
+// middleware, or for the default locale outside of it.
+func (h *Helpers) Localizer(r *http.Request) *i18n.Localizer {
+	if loc, ok := r.Context().Value(localizerContextKey).(*i18n.Localizer); ok {
+		return loc
 	}
+	return h.I18n.Localizer(h.I18n.Default)
 }
 
 // DecodePostForm decodes form data from an HTTP request into a destination struct.
@@ -110,3 +156,120 @@ func (h *Helpers) DecodePostForm(r *http.Request, dst any) error {
 
 	return nil
 }
+
+// DecodeQuery decodes the URL query parameters of a request into a destination
+// struct, for forms submitted with GET.
+func (h *Helpers) DecodeQuery(r *http.Request, dst any) error {
+	err := h.FormDecoder.Decode(dst, r.URL.Query())
+	if err != nil {
+		var invalidDecoderError *form.InvalidDecoderError
+		if errors.As(err, &invalidDecoderError) {
+			panic(err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// SnippetUnlocked returns true if the snippet is not password protected, or if
+// the password has already been entered successfully in the current session.
+func (h *Helpers) SnippetUnlocked(r *http.Request, s *models.Snippet) bool {
+	return !s.Protected() || h.sessionHasID(r, "unlockedSnippetIDs", s.ID)
+}
+
+// SnippetVisible returns true unless the snippet is private and the logged in
+// user isn't its author.
+func (h *Helpers) SnippetVisible(r *http.Request, s *models.Snippet) bool {
+	return s.Visibility != models.VisibilityPrivate || (s.UserID > 0 && s.UserID == h.AuthenticatedUserID(r))
+}
+
+// UnlockSnippet records in the session that the password for a snippet was entered correctly.
+func (h *Helpers) UnlockSnippet(r *http.Request, id int) {
+	h.sessionAddID(r, "unlockedSnippetIDs", id)
+}
+
+// OwnsSnippet returns true if the logged in user is the author of the
+// snippet. Snippets created without logging in are owned by the session they
+// were created in, or which followed the link in their expiry reminder.
+func (h *Helpers) OwnsSnippet(r *http.Request, s *models.Snippet) bool {
+	if s.UserID > 0 {
+		return s.UserID == h.AuthenticatedUserID(r)
+	}
+	return h.sessionHasID(r, "ownedSnippetIDs", s.ID)
+}
+
+// OwnSnippet records in the session that it owns a snippet created without
+// logging in.
+func (h *Helpers) OwnSnippet(r *http.Request, id int) {
+	h.sessionAddID(r, "ownedSnippetIDs", id)
+}
+
+// OwnedSnippetIDs returns the IDs of the snippets created in the current session.
+func (h *Helpers) OwnedSnippetIDs(r *http.Request) []int {
+	ids, _ := h.SessionManager.Get(r.Context(), "ownedSnippetIDs").([]int)
+	return ids
+}
+
+// sessionHasID reports whether id is in the list of IDs stored in the session under key.
+func (h *Helpers) sessionHasID(r *http.Request, key string, id int) bool {
+	ids, _ := h.SessionManager.Get(r.Context(), key).([]int)
+	for _, existing := range ids {
+		if existing == id {
+			return true
+		}
+	}
+	return false
+}
+
+// sessionAddID appends id to the list of IDs stored in the session under key.
+func (h *Helpers) sessionAddID(r *http.Request, key string, id int) {
+	if h.sessionHasID(r, key, id) {
+		return
+	}
+	ids, _ := h.SessionManager.Get(r.Context(), key).([]int)
+	h.SessionManager.Put(r.Context(), key, append(ids, id))
+}
+
+// IsAuthenticated returns true if a user is logged in in the current session.
+func (h *Helpers) IsAuthenticated(r *http.Request) bool {
+	return h.AuthenticatedUser(r) != nil
+}
+
+// AuthenticatedUser returns the logged in user, as loaded by the Authenticate
+// middleware, or nil if nobody is logged in.
+func (h *Helpers) AuthenticatedUser(r *http.Request) *models.User {
+	user, _ := r.Context().Value(authenticatedUserContextKey).(*models.User)
+	return user
+}
+
+// AuthenticatedUserID returns the ID of the logged in user, or 0 if nobody is
+// logged in.
+func (h *Helpers) AuthenticatedUserID(r *http.Request) int {
+	if user := h.AuthenticatedUser(r); user != nil {
+		return user.ID
+	}
+	return 0
+}
+
+// ClientIP returns the IP address of the client without the port.
+func (h *Helpers) ClientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// AuditEvent returns an audit event for the action, filled in with the
+// logged in user and the client's IP address, user agent and request ID.
+func (h *Helpers) AuditEvent(r *http.Request, action, target string) *models.AuditEvent {
+	return &models.AuditEvent{
+		Action:    action,
+		ActorID:   h.AuthenticatedUserID(r),
+		Target:    target,
+		IP:        h.ClientIP(r),
+		UserAgent: r.UserAgent(),
+		RequestID: RequestIDFromContext(r.Context()),
+	}
+}
@@ -1,10 +1,17 @@
 package middleware
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/Hiwiii/snippetbox.git/config"
+	"github.com/Hiwiii/snippetbox.git/internal/i18n"
+	"github.com/Hiwiii/snippetbox.git/internal/models"
 )
 
 // secureHeaders is a middleware that sets various security-related headers.
@@ -31,12 +38,32 @@ func SecureHeaders(next http.Handler) http.Handler {
 	})
 }
 
+// RequestID gives each request a random ID, which is added to the request
+// context and sent back in the X-Request-Id header. It ties log lines and
+// audit events to the request that caused them.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b := make([]byte, 16)
+		_, err := rand.Read(b)
+		if err != nil {
+			panic(err)
+		}
+		id := hex.EncodeToString(b)
+
+		w.Header().Set("X-Request-Id", id)
+
+		ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 // LogRequest logs information about each HTTP request.
 func LogRequest(app *config.Application) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Log the IP address, protocol, HTTP method, and requested URL.
-			app.InfoLog.Printf("%s - %s %s %s", r.RemoteAddr, r.Proto, r.Method, r.URL.RequestURI())
+			// Log the IP address, protocol, HTTP method, requested URL and
+			// request ID.
+			app.InfoLog.Printf("%s - %s %s %s %s", r.RemoteAddr, r.Proto, r.Method, r.URL.RequestURI(), RequestIDFromContext(r.Context()))
 
 			// Call the next handler in the chain.
 			next.ServeHTTP(w, r)
@@ -63,3 +90,119 @@ func RecoverPanic(app *config.Application, helpers *Helpers, next http.Handler)
 		next.ServeHTTP(w, r)
 	})
 }
+
+// contextKey is the type of the request context keys set by this package.
+type contextKey string
+
+const (
+	authenticatedUserContextKey = contextKey("authenticatedUser")
+	requestIDContextKey         = contextKey("requestID")
+	localizerContextKey         = contextKey("localizer")
+)
+
+// RequestIDFromContext returns the ID set by the RequestID middleware, or ""
+// if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey).(string)
+	return id
+}
+
+// Authenticate loads the user logged in in the current session and adds them
+// to the request context. Sessions of users who were deleted or disabled are
+// logged out.
+func Authenticate(app *config.Application, helpers *Helpers) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := helpers.SessionManager.GetInt(r.Context(), "authenticatedUserID")
+			if id == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			user, err := app.UserModel.Get(id)
+			if err != nil && !errors.Is(err, models.ErrNoRecord) {
+				helpers.ServerError(w, err)
+				return
+			}
+			if err != nil || user.Disabled {
+				helpers.SessionManager.Remove(r.Context(), "authenticatedUserID")
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Logged in users get a token for the forms behind VerifyCSRF.
+			err = helpers.ensureCSRFToken(r)
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), authenticatedUserContextKey, user)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Localize picks the locale of each request: the one chosen in the session if
+// it is still supported, or else the best match for the Accept-Language
+// header. Dates are shown in the time zone chosen in the session, or else the
+// one main.js detected in the browser and stored in the timezone cookie, or
+// else UTC. A Localizer for both is added to the request context.
+func Localize(helpers *Helpers) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tag := helpers.SessionManager.GetString(r.Context(), "locale")
+			if !helpers.I18n.Supported(tag) {
+				tag = helpers.I18n.Match(r.Header.Get("Accept-Language"))
+			}
+
+			// The same URL is rendered in different languages, so caches must
+			// take the header into account.
+			w.Header().Add("Vary", "Accept-Language")
+			w.Header().Set("Content-Language", tag)
+
+			zone := time.UTC
+			name := helpers.SessionManager.GetString(r.Context(), "timezone")
+			if name == "" {
+				if cookie, err := r.Cookie("timezone"); err == nil {
+					name = cookie.Value
+				}
+			}
+			if z, err := i18n.LoadZone(name); err == nil {
+				zone = z
+			}
+
+			loc := helpers.I18n.Localizer(tag).In(zone)
+			ctx := context.WithValue(r.Context(), localizerContextKey, loc)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequireRole only lets through users with at least the given role. Visitors
+// who aren't logged in are sent to log in, if single sign-on is configured.
+func RequireRole(helpers *Helpers, role models.Role) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := helpers.AuthenticatedUser(r)
+			if user == nil {
+				if helpers.LoginEnabled {
+					http.Redirect(w, r, "/login/oidc", http.StatusSeeOther)
+				} else {
+					helpers.NotFound(w)
+				}
+				return
+			}
+
+			if !user.Role.AtLeast(role) {
+				helpers.ClientError(w, http.StatusForbidden)
+				return
+			}
+
+			// Pages behind a role shouldn't be stored by shared caches.
+			w.Header().Add("Cache-Control", "no-store")
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
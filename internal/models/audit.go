@@ -0,0 +1,142 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Actions recorded in the audit log.
+const (
+	AuditSnippetCreate = "snippet.create"
+	AuditSnippetEdit   = "snippet.edit"
+	AuditSnippetDelete = "snippet.delete"
+	AuditLoginSuccess  = "login.success"
+	AuditLoginFailure  = "login.failure"
+	AuditLogout        = "logout"
+	AuditTwoFactorOn   = "2fa.enable"
+	AuditTwoFactorOff  = "2fa.disable"
+	AuditTokenCreate   = "token.create"
+	AuditAdminAction   = "admin.action"
+	AuditExport        = "audit.export"
+)
+
+// AuditActions lists the actions offered by the audit log filter.
+var AuditActions = []string{
+	AuditSnippetCreate,
+	AuditSnippetEdit,
+	AuditSnippetDelete,
+	AuditLoginSuccess,
+	AuditLoginFailure,
+	AuditLogout,
+	AuditTwoFactorOn,
+	AuditTwoFactorOff,
+	AuditTokenCreate,
+	AuditAdminAction,
+	AuditExport,
+}
+
+// AuditEvent is an entry in the audit log.
+type AuditEvent struct {
+	ID        int64
+	Created   time.Time
+	Action    string
+	ActorID   int    // 0 if nobody was logged in
+	Target    string // what the action was about, such as "snippet:12"
+	Details   string
+	IP        string
+	UserAgent string
+	RequestID string
+}
+
+// AuditFilter selects audit events. Zero fields match everything.
+type AuditFilter struct {
+	Action  string
+	ActorID int
+	Target  string
+	Since   time.Time // inclusive
+	Until   time.Time // exclusive
+	Limit   int
+}
+
+// Define an AuditModel type which wraps a sql.DB connection pool.
+type AuditModel struct {
+	DB *sql.DB
+}
+
+// Insert adds an event to the audit log.
+func (m *AuditModel) Insert(e *AuditEvent) error {
+	stmt := `INSERT INTO audit_events (created, action, actor_id, target, details, ip, user_agent, request_id)
+	VALUES(?, ?, ?, ?, ?, ?, ?, ?)`
+
+	result, err := m.DB.Exec(stmt, e.Created, e.Action, nullID(e.ActorID), e.Target, e.Details, e.IP, e.UserAgent, e.RequestID)
+	if err != nil {
+		return err
+	}
+
+	e.ID, err = result.LastInsertId()
+	return err
+}
+
+// Each calls fn for every event matching the filter, newest first. Rows are
+// streamed, so an unlimited filter can be used to export the whole log.
+func (m *AuditModel) Each(f AuditFilter, fn func(*AuditEvent) error) error {
+	var where []string
+	var args []any
+
+	if f.Action != "" {
+		where = append(where, "action = ?")
+		args = append(args, f.Action)
+	}
+	if f.ActorID > 0 {
+		where = append(where, "actor_id = ?")
+		args = append(args, f.ActorID)
+	}
+	if f.Target != "" {
+		where = append(where, "target = ?")
+		args = append(args, f.Target)
+	}
+	if !f.Since.IsZero() {
+		where = append(where, "created >= ?")
+		args = append(args, f.Since)
+	}
+	if !f.Until.IsZero() {
+		where = append(where, "created < ?")
+		args = append(args, f.Until)
+	}
+
+	stmt := `SELECT id, created, action, actor_id, target, details, ip, user_agent, request_id
+	         FROM audit_events`
+	if len(where) > 0 {
+		stmt += " WHERE " + strings.Join(where, " AND ")
+	}
+	stmt += " ORDER BY id DESC"
+	if f.Limit > 0 {
+		stmt += " LIMIT ?"
+		args = append(args, f.Limit)
+	}
+
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e := &AuditEvent{}
+		var actorID sql.NullInt32
+
+		err = rows.Scan(&e.ID, &e.Created, &e.Action, &actorID, &e.Target, &e.Details, &e.IP, &e.UserAgent, &e.RequestID)
+		if err != nil {
+			return err
+		}
+		e.ActorID = int(actorID.Int32)
+
+		err = fn(e)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
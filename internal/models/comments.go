@@ -0,0 +1,201 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Comment holds a comment on a snippet. A comment can be anchored to a range
+// of lines in one of the snippet's files, and can be a reply to another
+// comment. The fields correspond to the fields in the MySQL comments table.
+type Comment struct {
+	ID        int
+	SnippetID int
+	ParentID  int // 0 for top-level comments
+	FileID    int // 0 if the comment isn't anchored to a file
+	LineStart int
+	LineEnd   int
+	UserID    int    // 0 for comments from before accounts, or by deleted users
+	Author    string // name of the author's account
+	Body      string
+	Created   time.Time
+	Hidden    bool
+	Replies   []*Comment
+}
+
+// Anchored returns true if the comment refers to a range of lines.
+func (c *Comment) Anchored() bool {
+	return c.FileID > 0
+}
+
+// Define a CommentModel type which wraps a sql.DB connection pool.
+type CommentModel struct {
+	DB *sql.DB
+}
+
+// Insert adds a new comment by the user c.UserID to a snippet and returns its ID.
+func (m *CommentModel) Insert(c *Comment) (int, error) {
+	// Store NULL for the optional parent and anchor.
+	parentID := sql.NullInt32{Int32: int32(c.ParentID), Valid: c.ParentID > 0}
+	fileID := sql.NullInt32{Int32: int32(c.FileID), Valid: c.FileID > 0}
+	lineStart := sql.NullInt32{Int32: int32(c.LineStart), Valid: c.FileID > 0}
+	lineEnd := sql.NullInt32{Int32: int32(c.LineEnd), Valid: c.FileID > 0}
+
+	stmt := `INSERT INTO comments (snippet_id, parent_id, file_id, line_start, line_end, user_id, body, created, hidden)
+	VALUES(?, ?, ?, ?, ?, ?, ?, UTC_TIMESTAMP(), FALSE)`
+
+	result, err := m.DB.Exec(stmt, c.SnippetID, parentID, fileID, lineStart, lineEnd, c.UserID, c.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// Get returns a single comment, without its replies.
+func (m *CommentModel) Get(id int) (*Comment, error) {
+	stmt := `SELECT ` + commentColumns + ` FROM comments
+	         LEFT JOIN users ON users.id = comments.user_id
+	         WHERE comments.id = ?`
+
+	c, err := scanComment(m.DB.QueryRow(stmt, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// ForSnippet returns the top-level comments on a snippet, oldest first, with
+// their replies nested below them. Hidden comments, and the replies to them,
+// are only included if includeHidden is true.
+func (m *CommentModel) ForSnippet(snippetID int, includeHidden bool) ([]*Comment, error) {
+	stmt := `SELECT ` + commentColumns + ` FROM comments
+	         LEFT JOIN users ON users.id = comments.user_id
+	         WHERE comments.snippet_id = ? AND (? OR NOT comments.hidden)
+	         ORDER BY comments.id`
+
+	rows, err := m.DB.Query(stmt, snippetID, includeHidden)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	all := []*Comment{}
+
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		all = append(all, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return thread(all), nil
+}
+
+// SetHidden hides or unhides a comment on the given snippet.
+func (m *CommentModel) SetHidden(id, snippetID int, hidden bool) error {
+	stmt := `UPDATE comments SET hidden = ? WHERE id = ? AND snippet_id = ?`
+
+	result, err := m.DB.Exec(stmt, hidden, id, snippetID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	// MySQL reports zero affected rows when the value doesn't change, so
+	// check the comment exists before reporting it missing.
+	if rowsAffected == 0 {
+		c, err := m.Get(id)
+		if err != nil {
+			return err
+		}
+		if c.SnippetID != snippetID {
+			return ErrNoRecord
+		}
+	}
+
+	return nil
+}
+
+// Delete removes a comment on the given snippet, along with its replies.
+func (m *CommentModel) Delete(id, snippetID int) error {
+	result, err := m.DB.Exec(`DELETE FROM comments WHERE id = ? AND snippet_id = ?`, id, snippetID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// commentColumns lists the columns read by scanComment(). The author is the
+// name of the user's account, or the name typed in with comments from before
+// accounts existed.
+const commentColumns = `comments.id, comments.snippet_id, comments.parent_id, comments.file_id,
+	comments.line_start, comments.line_end, comments.user_id, COALESCE(users.name, comments.author, ''),
+	comments.body, comments.created, comments.hidden`
+
+// scanComment copies the commentColumns of a row into a new Comment struct.
+func scanComment(row rowScanner) (*Comment, error) {
+	c := &Comment{}
+	var parentID, fileID, lineStart, lineEnd, userID sql.NullInt32
+
+	err := row.Scan(&c.ID, &c.SnippetID, &parentID, &fileID, &lineStart, &lineEnd, &userID, &c.Author, &c.Body, &c.Created, &c.Hidden)
+	if err != nil {
+		return nil, err
+	}
+
+	c.UserID = int(userID.Int32)
+	c.ParentID = int(parentID.Int32)
+	c.FileID = int(fileID.Int32)
+	c.LineStart = int(lineStart.Int32)
+	c.LineEnd = int(lineEnd.Int32)
+
+	return c, nil
+}
+
+// thread nests the replies in a flat list of comments below their parents and
+// returns the top-level comments. Replies whose parent isn't in the list are
+// dropped. The list must be ordered by ID, so parents come before replies.
+func thread(all []*Comment) []*Comment {
+	byID := make(map[int]*Comment, len(all))
+	top := []*Comment{}
+
+	for _, c := range all {
+		byID[c.ID] = c
+
+		if c.ParentID == 0 {
+			top = append(top, c)
+		} else if parent, ok := byID[c.ParentID]; ok {
+			parent.Replies = append(parent.Replies, c)
+		}
+	}
+
+	return top
+}
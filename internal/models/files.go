@@ -0,0 +1,87 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// SnippetFile is one named file within a snippet. The fields correspond to the
+// fields in the MySQL snippet_files table.
+type SnippetFile struct {
+	ID       int
+	Name     string
+	Language string
+	Content  string
+}
+
+// Languages lists the languages a snippet file can be marked as.
+var Languages = []string{
+	"text", "bash", "c", "cpp", "csharp", "css", "go", "html", "java",
+	"javascript", "json", "kotlin", "markdown", "php", "python", "ruby",
+	"rust", "sql", "swift", "typescript", "yaml",
+}
+
+// nonAnchorChars matches the characters which aren't allowed in HTML anchors.
+var nonAnchorChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Anchor returns the fragment identifier used to link to the file on the view page.
+func (f *SnippetFile) Anchor() string {
+	slug := nonAnchorChars.ReplaceAllString(strings.ToLower(f.Name), "-")
+	return fmt.Sprintf("file-%d-%s", f.ID, strings.Trim(slug, "-"))
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx, so the file queries can
+// run inside or outside a transaction.
+type queryer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// insertFiles inserts the files for a snippet, keeping them in the given order.
+func insertFiles(q queryer, snippetID int, files []*SnippetFile) error {
+	stmt := `INSERT INTO snippet_files (snippet_id, position, name, language, content)
+	VALUES(?, ?, ?, ?, ?)`
+
+	for i, f := range files {
+		_, err := q.Exec(stmt, snippetID, i, f.Name, f.Language, f.Content)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getFiles returns the files for a snippet in the order they were added.
+func getFiles(q queryer, snippetID int) ([]*SnippetFile, error) {
+	stmt := `SELECT id, name, language, content FROM snippet_files
+	         WHERE snippet_id = ?
+	         ORDER BY position`
+
+	rows, err := q.Query(stmt, snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := []*SnippetFile{}
+
+	for rows.Next() {
+		f := &SnippetFile{}
+
+		err = rows.Scan(&f.ID, &f.Name, &f.Language, &f.Content)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, f)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
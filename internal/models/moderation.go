@@ -0,0 +1,87 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Moderation actions recorded in the audit trail.
+const (
+	ActionDismiss  = "dismiss"
+	ActionHide     = "hide"
+	ActionAutoHide = "auto-hide"
+	ActionDelete   = "delete"
+	ActionBan      = "ban"
+	ActionDisable  = "disable"
+	ActionEnable   = "enable"
+	ActionSetRole  = "set-role"
+	ActionReset2FA = "reset-2fa"
+)
+
+// ModerationAction is an entry in the audit trail of moderation.
+type ModerationAction struct {
+	ID           int
+	ModeratorID  int // 0 for actions taken automatically
+	Action       string
+	SnippetID    int
+	TargetUserID int
+	Note         string
+	Created      time.Time
+}
+
+// Define a ModerationModel type which wraps a sql.DB connection pool.
+type ModerationModel struct {
+	DB *sql.DB
+}
+
+// Record adds an action to the audit trail. Zero IDs are stored as NULL.
+func (m *ModerationModel) Record(a *ModerationAction) error {
+	stmt := `INSERT INTO moderation_actions (moderator_id, action, snippet_id, target_user_id, note, created)
+	VALUES(?, ?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	_, err := m.DB.Exec(stmt, nullID(a.ModeratorID), a.Action, nullID(a.SnippetID), nullID(a.TargetUserID), a.Note)
+	return err
+}
+
+// Latest returns the 100 most recent moderation actions.
+func (m *ModerationModel) Latest() ([]*ModerationAction, error) {
+	stmt := `SELECT id, moderator_id, action, snippet_id, target_user_id, note, created
+	         FROM moderation_actions
+	         ORDER BY id DESC
+	         LIMIT 100`
+
+	rows, err := m.DB.Query(stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	actions := []*ModerationAction{}
+
+	for rows.Next() {
+		a := &ModerationAction{}
+		var moderatorID, snippetID, targetUserID sql.NullInt32
+
+		err = rows.Scan(&a.ID, &moderatorID, &a.Action, &snippetID, &targetUserID, &a.Note, &a.Created)
+		if err != nil {
+			return nil, err
+		}
+
+		a.ModeratorID = int(moderatorID.Int32)
+		a.SnippetID = int(snippetID.Int32)
+		a.TargetUserID = int(targetUserID.Int32)
+
+		actions = append(actions, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return actions, nil
+}
+
+// nullID returns a NULL for a zero ID.
+func nullID(id int) sql.NullInt32 {
+	return sql.NullInt32{Int32: int32(id), Valid: id > 0}
+}
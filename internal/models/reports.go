@@ -0,0 +1,184 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// ReportReason is a category a snippet can be reported under.
+type ReportReason struct {
+	Value string
+	Label string
+}
+
+// ReportReasons lists the categories offered on the report form.
+var ReportReasons = []ReportReason{
+	{"secret", "Leaked credentials or secrets"},
+	{"abuse", "Abusive or hateful content"},
+	{"spam", "Spam or advertising"},
+	{"illegal", "Illegal content"},
+	{"other", "Something else"},
+}
+
+// PermittedReportReasons returns the values of the ReportReasons.
+func PermittedReportReasons() []string {
+	values := make([]string, len(ReportReasons))
+	for i, reason := range ReportReasons {
+		values[i] = reason.Value
+	}
+	return values
+}
+
+// Report is a complaint about a snippet.
+type Report struct {
+	ID        int
+	SnippetID int
+	Reason    string
+	Details   string
+	Created   time.Time
+}
+
+// ReasonLabel returns the description of the report's reason.
+func (r *Report) ReasonLabel() string {
+	for _, reason := range ReportReasons {
+		if reason.Value == r.Reason {
+			return reason.Label
+		}
+	}
+	return r.Reason
+}
+
+// ReportedSnippet is a snippet in the moderation queue along with its open
+// reports, oldest first.
+type ReportedSnippet struct {
+	SnippetID int
+	Title     string
+	UserID    int // 0 if the snippet was created without logging in
+	Hidden    bool
+	Reports   []*Report
+}
+
+// Define a ReportModel type which wraps a sql.DB connection pool.
+type ReportModel struct {
+	DB *sql.DB
+}
+
+// Insert files a report about a snippet and returns the number of open
+// reports the snippet now has. reporter identifies who filed the report; each
+// reporter can only report a snippet once, and later reports are ignored.
+func (m *ReportModel) Insert(snippetID int, reason, details, reporter string) (int, error) {
+	key := sha256.Sum256([]byte(reporter))
+
+	stmt := `INSERT INTO reports (snippet_id, reason, details, reporter_key, created)
+	VALUES(?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	_, err := m.DB.Exec(stmt, snippetID, reason, details, key[:])
+	if err != nil {
+		var mySQLError *mysql.MySQLError
+		// 1062 is a duplicate key error, from the reports_uc_reporter constraint.
+		if !errors.As(err, &mySQLError) || mySQLError.Number != 1062 {
+			return 0, err
+		}
+	}
+
+	var open int
+
+	stmt = `SELECT COUNT(*) FROM reports WHERE snippet_id = ? AND resolved IS NULL`
+
+	err = m.DB.QueryRow(stmt, snippetID).Scan(&open)
+	if err != nil {
+		return 0, err
+	}
+
+	return open, nil
+}
+
+// Queue returns the snippets with open reports, oldest report first.
+func (m *ReportModel) Queue() ([]*ReportedSnippet, error) {
+	return m.queue(0)
+}
+
+// Open returns a snippet with its open reports, or ErrNoRecord if there are
+// none.
+func (m *ReportModel) Open(snippetID int) (*ReportedSnippet, error) {
+	queue, err := m.queue(snippetID)
+	if err != nil {
+		return nil, err
+	}
+	if len(queue) == 0 {
+		return nil, ErrNoRecord
+	}
+	return queue[0], nil
+}
+
+// queue returns the snippets with open reports, limited to one snippet if
+// snippetID isn't zero.
+func (m *ReportModel) queue(snippetID int) ([]*ReportedSnippet, error) {
+	stmt := `SELECT reports.id, reports.snippet_id, reports.reason, reports.details, reports.created,
+	         snippets.title, snippets.user_id, snippets.hidden
+	         FROM reports
+	         JOIN snippets ON snippets.id = reports.snippet_id
+	         WHERE reports.resolved IS NULL AND (? = 0 OR reports.snippet_id = ?)
+	         ORDER BY reports.id`
+
+	rows, err := m.DB.Query(stmt, snippetID, snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	queue := []*ReportedSnippet{}
+	bySnippet := make(map[int]*ReportedSnippet)
+
+	for rows.Next() {
+		r := &Report{}
+		s := &ReportedSnippet{}
+		var userID sql.NullInt32
+
+		err = rows.Scan(&r.ID, &r.SnippetID, &r.Reason, &r.Details, &r.Created, &s.Title, &userID, &s.Hidden)
+		if err != nil {
+			return nil, err
+		}
+
+		// Snippets are queued in the order of their first open report.
+		if existing, ok := bySnippet[r.SnippetID]; ok {
+			s = existing
+		} else {
+			s.SnippetID = r.SnippetID
+			s.UserID = int(userID.Int32)
+			bySnippet[r.SnippetID] = s
+			queue = append(queue, s)
+		}
+		s.Reports = append(s.Reports, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return queue, nil
+}
+
+// CountOpen returns the number of snippets with open reports.
+func (m *ReportModel) CountOpen() (int, error) {
+	var count int
+
+	stmt := `SELECT COUNT(DISTINCT snippet_id) FROM reports WHERE resolved IS NULL`
+
+	err := m.DB.QueryRow(stmt).Scan(&count)
+	return count, err
+}
+
+// Resolve closes the open reports about a snippet, recording how they were
+// resolved.
+func (m *ReportModel) Resolve(snippetID int, resolution string) error {
+	stmt := `UPDATE reports SET resolved = UTC_TIMESTAMP(), resolution = ?
+	         WHERE snippet_id = ? AND resolved IS NULL`
+
+	_, err := m.DB.Exec(stmt, resolution, snippetID)
+	return err
+}
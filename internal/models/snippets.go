@@ -1,19 +1,118 @@
 package models
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
+
+	"github.com/Hiwiii/snippetbox.git/internal/expiry"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// Visibility controls who can find and see a snippet.
+type Visibility string
+
+const (
+	// VisibilityPublic snippets are listed on the home, tag and profile pages.
+	VisibilityPublic Visibility = "public"
+	// VisibilityUnlisted snippets can be seen by anyone with the link, but
+	// aren't listed anywhere.
+	VisibilityUnlisted Visibility = "unlisted"
+	// VisibilityPrivate snippets can only be seen by their author.
+	VisibilityPrivate Visibility = "private"
+)
+
+// Visibilities lists the visibilities offered on the create form.
+var Visibilities = []Visibility{VisibilityPublic, VisibilityUnlisted, VisibilityPrivate}
+
 // Define a Snippet type to hold the data for an individual snippet.
 // The fields correspond to the fields in the MySQL snippets table.
 type Snippet struct {
-	ID      int
-	Title   string
-	Content string
-	Created time.Time
-	Expires time.Time
+	ID             int
+	Title          string
+	Files          []*SnippetFile
+	Tags           []string
+	ForkedFrom     int        // 0 if the snippet isn't a fork
+	NotifyEmail    string     // only loaded by DueForNotification
+	UserID         int        // 0 if the snippet was created without logging in
+	Hidden         bool       // hidden by moderators
+	Visibility     Visibility // who can find and see the snippet
+	Stars          int        // number of users who starred the snippet
+	Created        time.Time
+	Expires        time.Time
+	HashedPassword []byte
+	RemainingViews sql.NullInt32
+}
+
+// NeverExpires returns true if the snippet was created without an expiry time.
+func (s *Snippet) NeverExpires() bool {
+	return !s.Expires.Before(expiry.NeverExpires)
+}
+
+// ViewLimited returns true if the snippet can only be viewed a limited number of times.
+func (s *Snippet) ViewLimited() bool {
+	return s.RemainingViews.Valid
+}
+
+// Protected returns true if the snippet requires a password before it can be viewed.
+func (s *Snippet) Protected() bool {
+	return len(s.HashedPassword) > 0
+}
+
+// PasswordMatches checks the plain-text password against the snippet's bcrypt hash.
+// Snippets without a password never match.
+func (s *Snippet) PasswordMatches(password string) (bool, error) {
+	if !s.Protected() {
+		return false, nil
+	}
+
+	err := bcrypt.CompareHashAndPassword(s.HashedPassword, []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// snippetColumns lists the columns read by scanSnippet(). The tags are
+// aggregated into a single comma-separated column, and the stars are counted.
+const snippetColumns = `snippets.id, snippets.title, snippets.created, snippets.expires,
+	snippets.hashed_password, snippets.remaining_views, snippets.forked_from, snippets.user_id, snippets.hidden,
+	snippets.visibility, (SELECT GROUP_CONCAT(tags.name ORDER BY tags.name) FROM snippet_tags
+	 JOIN tags ON tags.id = snippet_tags.tag_id
+	 WHERE snippet_tags.snippet_id = snippets.id),
+	(SELECT COUNT(*) FROM stars WHERE stars.snippet_id = snippets.id)`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanSnippet copies the snippetColumns of a row into a new Snippet struct.
+func scanSnippet(row rowScanner) (*Snippet, error) {
+	s := &Snippet{}
+	var forkedFrom, userID sql.NullInt32
+	var tags sql.NullString
+
+	err := row.Scan(&s.ID, &s.Title, &s.Created, &s.Expires, &s.HashedPassword, &s.RemainingViews, &forkedFrom, &userID, &s.Hidden, &s.Visibility, &tags, &s.Stars)
+	if err != nil {
+		return nil, err
+	}
+
+	s.ForkedFrom = int(forkedFrom.Int32)
+	s.UserID = int(userID.Int32)
+
+	if tags.Valid {
+		s.Tags = strings.Split(tags.String, ",")
+	}
+
+	return s, nil
 }
 
 // Define a SnippetModel type which wraps a sql.DB connection pool.
@@ -21,14 +120,47 @@ type SnippetModel struct {
 	DB *sql.DB
 }
 
-// Insert inserts a new snippet into the database.
-// Insert inserts a new snippet into the database.
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
+// Insert inserts a new snippet with its files and tags into the database,
+// using the Title, Files, Tags, Expires, ForkedFrom, NotifyEmail, UserID and
+// Visibility fields of s. If password is not empty the snippet is protected
+// and only its bcrypt hash is stored. A maxViews greater than zero limits how
+// many times the snippet can be viewed before it is deleted.
+func (m *SnippetModel) Insert(s *Snippet, password string, maxViews int) (int, error) {
+	// Hash the password, leaving the column NULL for unprotected snippets.
+	var hashedPassword []byte
+	if password != "" {
+		var err error
+		hashedPassword, err = bcrypt.GenerateFromPassword([]byte(password), 12)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// Leave remaining_views NULL for snippets that can be viewed any number of times.
+	remainingViews := sql.NullInt32{Int32: int32(maxViews), Valid: maxViews > 0}
+
+	// Leave forked_from NULL for snippets which aren't forks.
+	forkedFrom := sql.NullInt32{Int32: int32(s.ForkedFrom), Valid: s.ForkedFrom > 0}
+
+	// Leave notify_email NULL if no expiry reminder was requested.
+	notifyEmail := sql.NullString{String: s.NotifyEmail, Valid: s.NotifyEmail != ""}
 
-	stmt := `INSERT INTO snippets (title, content, created, expires)
-	VALUES(?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))`
+	// Leave user_id NULL for snippets created without logging in.
+	userID := sql.NullInt32{Int32: int32(s.UserID), Valid: s.UserID > 0}
 
-	result, err := m.DB.Exec(stmt, title, content, expires)
+	// Insert the snippet and its files together, so a failure part way
+	// through doesn't leave a snippet without files.
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	stmt := `INSERT INTO snippets (title, created, expires, hashed_password, remaining_views, forked_from, notify_email, user_id, visibility)
+	VALUES(?, UTC_TIMESTAMP(), ?, ?, ?, ?, ?, ?, ?)`
+
+	result, err := tx.Exec(stmt, s.Title, s.Expires.UTC(), hashedPassword, remainingViews, forkedFrom, notifyEmail, userID, s.Visibility)
 	if err != nil {
 		return 0, err
 	}
@@ -40,25 +172,47 @@ func (m *SnippetModel) Insert(title string, content string, expires int) (int, e
 		return 0, err
 	}
 
+	err = insertFiles(tx, int(id), s.Files)
+	if err != nil {
+		return 0, err
+	}
+
+	err = insertTags(tx, int(id), s.Tags)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
 	// The ID returned has the type int64, so we convert it to an int type
 	// before returning.
 	return int(id), nil
 }
 
-// Get returns a specific snippet based on its id.
+// Get returns a specific snippet, including its files, based on its id.
+// Snippets hidden by moderators are not returned.
 func (m *SnippetModel) Get(id int) (*Snippet, error) {
-	// Write the SQL statement to execute
-	stmt := `SELECT id, title, content, created, expires FROM snippets 
-			 WHERE expires > UTC_TIMESTAMP() AND id = ?`
+	return m.get(id, false)
+}
 
-	// Use the QueryRow() method to execute the statement and return a sql.Row object
-	row := m.DB.QueryRow(stmt, id)
+// GetIncludingHidden is like Get, but also returns snippets hidden by
+// moderators. It is meant for moderators.
+func (m *SnippetModel) GetIncludingHidden(id int) (*Snippet, error) {
+	return m.get(id, true)
+}
 
-	// Initialize a pointer to a new zeroed Snippet struct
-	s := &Snippet{}
+// get returns a snippet which hasn't expired, including its files.
+func (m *SnippetModel) get(id int, includeHidden bool) (*Snippet, error) {
+	// Write the SQL statement to execute
+	stmt := `SELECT ` + snippetColumns + ` FROM snippets
+			 WHERE expires > UTC_TIMESTAMP() AND id = ? AND (hidden = FALSE OR ?)`
 
-	// Use row.Scan() to copy the values from the sql.Row into the Snippet struct fields
-	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+	// Use the QueryRow() method to execute the statement and return a sql.Row object,
+	// then copy the values from the sql.Row into a new Snippet struct
+	s, err := scanSnippet(m.DB.QueryRow(stmt, id, includeHidden))
 	if err != nil {
 		// If the query returns no rows, row.Scan() will return a sql.ErrNoRows error
 		// Handle that specific error and return a custom ErrNoRecord error
@@ -69,23 +223,291 @@ func (m *SnippetModel) Get(id int) (*Snippet, error) {
 		}
 	}
 
+	// Load the files which make up the snippet
+	s.Files, err = getFiles(m.DB, s.ID)
+	if err != nil {
+		return nil, err
+	}
+
 	// If everything is OK, return the Snippet object
 	return s, nil
 }
 
-// Latest returns the 10 most recently created snippets.
-func (m *SnippetModel) Latest() ([]*Snippet, error) {
+// Extend moves the expiry time of a snippet that hasn't expired yet to a later
+// time. It returns ErrNoRecord if the snippet doesn't exist, has expired or
+// already expires at or after the given time.
+func (m *SnippetModel) Extend(id int, expires time.Time) error {
+	stmt := `UPDATE snippets SET expires = ?
+	         WHERE id = ? AND expires > UTC_TIMESTAMP() AND expires < ?`
+
+	result, err := m.DB.Exec(stmt, expires.UTC(), id, expires.UTC())
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Consume uses up one view of a view-limited snippet and returns it. The
+// decrement is a single conditional UPDATE, so when several clients race for
+// the last view only one of them gets the snippet and the others receive
+// ErrNoRecord. Once no views remain the snippet is deleted.
+func (m *SnippetModel) Consume(id int) (*Snippet, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	stmt := `UPDATE snippets SET remaining_views = remaining_views - 1
+	         WHERE id = ? AND remaining_views > 0 AND expires > UTC_TIMESTAMP() AND hidden = FALSE`
+
+	result, err := tx.Exec(stmt, id)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		return nil, ErrNoRecord
+	}
+
+	// The UPDATE holds a lock on the row until commit, so this read sees our decrement.
+	stmt = `SELECT ` + snippetColumns + ` FROM snippets
+	        WHERE id = ?`
+
+	s, err := scanSnippet(tx.QueryRow(stmt, id))
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the files before a possible delete removes them along with the snippet.
+	s.Files, err = getFiles(tx, s.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Burn the snippet once its last view has been handed out.
+	if s.RemainingViews.Int32 <= 0 {
+		_, err = tx.Exec(`DELETE FROM snippets WHERE id = ?`, id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// DueForNotification returns the snippets which asked for an expiry reminder,
+// haven't had one yet, and expire after now but no later than before. Only
+// the ID, Title, Expires and NotifyEmail fields are loaded.
+func (m *SnippetModel) DueForNotification(now, before time.Time) ([]*Snippet, error) {
+	stmt := `SELECT id, title, expires, notify_email FROM snippets
+	         WHERE notify_email IS NOT NULL AND notified_at IS NULL
+	         AND expires > ? AND expires <= ?
+	         ORDER BY expires`
+
+	rows, err := m.DB.Query(stmt, now.UTC(), before.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snippets := []*Snippet{}
+
+	for rows.Next() {
+		s := &Snippet{}
+
+		err = rows.Scan(&s.ID, &s.Title, &s.Expires, &s.NotifyEmail)
+		if err != nil {
+			return nil, err
+		}
+
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// ClaimNotification marks the expiry reminder for a snippet as sent and stores
+// the hash of the token that lets the recipient manage the snippet. It returns
+// false if the reminder had already been claimed, so that concurrent senders
+// can't both send it.
+func (m *SnippetModel) ClaimNotification(id int, token string) (bool, error) {
+	hash := sha256.Sum256([]byte(token))
+
+	stmt := `UPDATE snippets SET notified_at = UTC_TIMESTAMP(), manage_token_hash = ?
+	         WHERE id = ? AND notified_at IS NULL`
+
+	result, err := m.DB.Exec(stmt, hash[:], id)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// ReleaseNotification undoes ClaimNotification after a reminder could not be
+// sent, so that it is tried again later.
+func (m *SnippetModel) ReleaseNotification(id int) error {
+	stmt := `UPDATE snippets SET notified_at = NULL, manage_token_hash = NULL WHERE id = ?`
+
+	_, err := m.DB.Exec(stmt, id)
+	return err
+}
+
+// ManageTokenMatches checks a token from an expiry reminder against the hash
+// stored for a snippet which hasn't expired.
+func (m *SnippetModel) ManageTokenMatches(id int, token string) (bool, error) {
+	var stored []byte
+
+	stmt := `SELECT manage_token_hash FROM snippets WHERE id = ? AND expires > UTC_TIMESTAMP()`
+
+	err := m.DB.QueryRow(stmt, id).Scan(&stored)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	hash := sha256.Sum256([]byte(token))
+	return len(stored) > 0 && subtle.ConstantTimeCompare(stored, hash[:]) == 1, nil
+}
+
+// Exists returns true if a snippet with the id exists, hasn't expired and
+// isn't hidden or private.
+func (m *SnippetModel) Exists(id int) (bool, error) {
+	var exists bool
+
+	stmt := `SELECT EXISTS(SELECT true FROM snippets
+	         WHERE id = ? AND expires > UTC_TIMESTAMP() AND hidden = FALSE AND visibility <> 'private')`
+
+	err := m.DB.QueryRow(stmt, id).Scan(&exists)
+	return exists, err
+}
+
+// Forks returns up to 50 of the most recent snippets forked from the snippet
+// with the given id which are public and haven't expired or been hidden. The
+// files of the forks are not loaded.
+func (m *SnippetModel) Forks(id int) ([]*Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + `
+	         FROM snippets
+	         WHERE forked_from = ? AND expires > UTC_TIMESTAMP() AND hidden = FALSE AND visibility = 'public'
+	         ORDER BY id DESC
+	         LIMIT 50`
+
+	rows, err := m.DB.Query(stmt, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	forks := []*Snippet{}
+
+	for rows.Next() {
+		s, err := scanSnippet(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		forks = append(forks, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return forks, nil
+}
+
+// GetMany returns the snippets with the given ids which haven't expired and
+// aren't hidden, newest first. The files of the snippets are not loaded.
+func (m *SnippetModel) GetMany(ids []int) ([]*Snippet, error) {
+	snippets := []*Snippet{}
+	if len(ids) == 0 {
+		return snippets, nil
+	}
+
+	// Build one placeholder per id for the IN clause.
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+
+	stmt := `SELECT ` + snippetColumns + `
+	         FROM snippets
+	         WHERE id IN (` + placeholders + `) AND expires > UTC_TIMESTAMP() AND hidden = FALSE
+	         ORDER BY id DESC`
+
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		s, err := scanSnippet(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// Latest returns the 10 most recently created public snippets which aren't
+// hidden. If tag is not empty only snippets with that tag are returned. The files of the
+// snippets are not loaded.
+func (m *SnippetModel) Latest(tag string) ([]*Snippet, error) {
 	// Write the SQL statement to execute. It selects the 10 most recent snippets
 	// where the expiry date is still in the future, ordered by descending ID.
-	stmt := `SELECT id, title, content, created, expires 
+	// An empty tag matches every snippet.
+	stmt := `SELECT ` + snippetColumns + `
 	         FROM snippets
-	         WHERE expires > UTC_TIMESTAMP()
+	         WHERE expires > UTC_TIMESTAMP() AND hidden = FALSE AND visibility = 'public'
+	         AND (? = '' OR EXISTS (SELECT 1 FROM snippet_tags
+	              JOIN tags ON tags.id = snippet_tags.tag_id
+	              WHERE snippet_tags.snippet_id = snippets.id AND tags.name = ?))
 	         ORDER BY id DESC 
 	         LIMIT 10`
 
 	// Use the Query() method to execute the SQL statement. This returns a
 	// *sql.Rows result set containing the result of the query.
-	rows, err := m.DB.Query(stmt)
+	rows, err := m.DB.Query(stmt, tag, tag)
 	if err != nil {
 		return nil, err
 	}
@@ -97,12 +519,8 @@ func (m *SnippetModel) Latest() ([]*Snippet, error) {
 
 	// Use rows.Next() to iterate through the rows in the result set.
 	for rows.Next() {
-		// Create a pointer to a new zeroed Snippet struct.
-		s := &Snippet{}
-
-		// Use rows.Scan() to copy the values from each field in the row to
-		// the corresponding field in the Snippet struct.
-		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+		// Copy the values from each field in the row to a new Snippet struct.
+		s, err := scanSnippet(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -120,3 +538,105 @@ func (m *SnippetModel) Latest() ([]*Snippet, error) {
 	// If everything went OK, return the slice of snippets.
 	return snippets, nil
 }
+
+// ByUser returns up to limit snippets by a user which haven't expired and
+// aren't hidden, newest first, skipping the first offset. Unless
+// includeUnlisted is true, only public snippets are returned; otherwise
+// unlisted and private ones are too. The files of the snippets are not
+// loaded.
+func (m *SnippetModel) ByUser(userID int, includeUnlisted bool, limit, offset int) ([]*Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + `
+	         FROM snippets
+	         WHERE user_id = ? AND expires > UTC_TIMESTAMP() AND hidden = FALSE
+	         AND (? OR visibility = 'public')
+	         ORDER BY id DESC
+	         LIMIT ? OFFSET ?`
+
+	rows, err := m.DB.Query(stmt, userID, includeUnlisted, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snippets := []*Snippet{}
+
+	for rows.Next() {
+		s, err := scanSnippet(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// Search returns up to 50 snippets, newest first and including expired and
+// hidden ones, whose title contains q or whose ID is q. An empty q matches every snippet.
+// The files of the snippets are not loaded.
+func (m *SnippetModel) Search(q string) ([]*Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + `
+	         FROM snippets
+	         WHERE title LIKE ? OR id = ?
+	         ORDER BY id DESC
+	         LIMIT 50`
+
+	rows, err := m.DB.Query(stmt, likePattern(q), q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snippets := []*Snippet{}
+
+	for rows.Next() {
+		s, err := scanSnippet(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// SetHidden hides a snippet from everyone but moderators, or shows it again.
+func (m *SnippetModel) SetHidden(id int, hidden bool) error {
+	_, err := m.DB.Exec(`UPDATE snippets SET hidden = ? WHERE id = ?`, hidden, id)
+	return err
+}
+
+// Delete removes a snippet along with its files, tags and comments, whether or
+// not it has expired.
+func (m *SnippetModel) Delete(id int) error {
+	result, err := m.DB.Exec(`DELETE FROM snippets WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// likePattern returns a LIKE pattern matching strings which contain s.
+func likePattern(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+	return "%" + s + "%"
+}
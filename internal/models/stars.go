@@ -0,0 +1,109 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Define a StarModel type which wraps a sql.DB connection pool.
+type StarModel struct {
+	DB *sql.DB
+}
+
+// Add stars a snippet for a user. Starring a snippet twice has no effect.
+func (m *StarModel) Add(userID, snippetID int) error {
+	stmt := `INSERT IGNORE INTO stars (user_id, snippet_id, created) VALUES(?, ?, UTC_TIMESTAMP())`
+
+	_, err := m.DB.Exec(stmt, userID, snippetID)
+	return err
+}
+
+// Remove unstars a snippet for a user. Unstarring a snippet which isn't
+// starred has no effect.
+func (m *StarModel) Remove(userID, snippetID int) error {
+	_, err := m.DB.Exec(`DELETE FROM stars WHERE user_id = ? AND snippet_id = ?`, userID, snippetID)
+	return err
+}
+
+// Exists returns true if the user has starred the snippet.
+func (m *StarModel) Exists(userID, snippetID int) (bool, error) {
+	var exists bool
+
+	stmt := `SELECT EXISTS(SELECT true FROM stars WHERE user_id = ? AND snippet_id = ?)`
+
+	err := m.DB.QueryRow(stmt, userID, snippetID).Scan(&exists)
+	return exists, err
+}
+
+// Starred returns the snippets a user has starred which haven't expired and
+// aren't hidden, most recently starred first. Private snippets are only
+// returned to their author. The files of the snippets are not loaded.
+func (m *StarModel) Starred(userID int) ([]*Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + `
+	         FROM stars
+	         JOIN snippets ON snippets.id = stars.snippet_id
+	         WHERE stars.user_id = ? AND snippets.expires > UTC_TIMESTAMP() AND snippets.hidden = FALSE
+	         AND (snippets.visibility <> 'private' OR snippets.user_id = stars.user_id)
+	         ORDER BY stars.id DESC`
+
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snippets := []*Snippet{}
+
+	for rows.Next() {
+		s, err := scanSnippet(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// MostStarred returns up to limit public snippets which haven't expired and
+// aren't hidden, with the most stars given since the given time first. Only the
+// stars given since then are read, through idx_stars_created, rather than
+// the whole table. The files of the snippets are not loaded.
+func (m *StarModel) MostStarred(since time.Time, limit int) ([]*Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + `
+	         FROM (SELECT snippet_id, COUNT(*) AS recent FROM stars
+	               WHERE created >= ?
+	               GROUP BY snippet_id) AS recent_stars
+	         JOIN snippets ON snippets.id = recent_stars.snippet_id
+	         WHERE snippets.expires > UTC_TIMESTAMP() AND snippets.hidden = FALSE AND snippets.visibility = 'public'
+	         ORDER BY recent_stars.recent DESC, snippets.id DESC
+	         LIMIT ?`
+
+	rows, err := m.DB.Query(stmt, since.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snippets := []*Snippet{}
+
+	for rows.Next() {
+		s, err := scanSnippet(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
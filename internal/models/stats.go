@@ -0,0 +1,92 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// DayCount is the number of snippets created on a day.
+type DayCount struct {
+	Day   time.Time
+	Count int
+}
+
+// Stats holds aggregate figures for the admin dashboard.
+type Stats struct {
+	SnippetsPerDay []*DayCount // oldest first, one entry for every day
+	LiveSnippets   int
+	Users          int
+	ActiveUsers    int   // users who logged in within the activity window
+	StorageBytes   int64 // size of the content of all stored snippet files
+}
+
+// Define a StatsModel type which wraps a sql.DB connection pool.
+type StatsModel struct {
+	DB *sql.DB
+}
+
+// BusiestDay returns the highest number of snippets created on one day.
+func (s *Stats) BusiestDay() int {
+	busiest := 0
+	for _, d := range s.SnippetsPerDay {
+		busiest = max(busiest, d.Count)
+	}
+	return busiest
+}
+
+// Get computes the stats, counting snippets created on each of the last days
+// days (in UTC, including today) and users who logged in after activeSince.
+func (m *StatsModel) Get(days int, activeSince time.Time) (*Stats, error) {
+	stats := &Stats{}
+
+	// Start with a zero count for every day, so that quiet days show up.
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	counts := make(map[string]*DayCount, days)
+	for i := days - 1; i >= 0; i-- {
+		d := &DayCount{Day: today.AddDate(0, 0, -i)}
+		counts[d.Day.Format(time.DateOnly)] = d
+		stats.SnippetsPerDay = append(stats.SnippetsPerDay, d)
+	}
+
+	stmt := `SELECT DATE(created), COUNT(*) FROM snippets
+	         WHERE created >= UTC_DATE() - INTERVAL ? DAY
+	         GROUP BY DATE(created)
+	         ORDER BY DATE(created)`
+
+	rows, err := m.DB.Query(stmt, days-1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var day time.Time
+		var count int
+
+		err = rows.Scan(&day, &count)
+		if err != nil {
+			return nil, err
+		}
+
+		if d, ok := counts[day.Format(time.DateOnly)]; ok {
+			d.Count = count
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	stmt = `SELECT
+	        (SELECT COUNT(*) FROM snippets WHERE expires > UTC_TIMESTAMP()),
+	        (SELECT COUNT(*) FROM users),
+	        (SELECT COUNT(*) FROM users WHERE last_login > ?),
+	        (SELECT COALESCE(SUM(LENGTH(content)), 0) FROM snippet_files)`
+
+	err = m.DB.QueryRow(stmt, activeSince.UTC()).Scan(&stats.LiveSnippets, &stats.Users, &stats.ActiveUsers, &stats.StorageBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,72 @@
+package models
+
+import "database/sql"
+
+// Tag holds a tag name and the number of live snippets carrying it.
+type Tag struct {
+	Name  string
+	Count int
+}
+
+// Define a TagModel type which wraps a sql.DB connection pool.
+type TagModel struct {
+	DB *sql.DB
+}
+
+// Popular returns up to limit tags, most used first, counting only public
+// snippets which haven't expired and aren't hidden.
+func (m *TagModel) Popular(limit int) ([]*Tag, error) {
+	stmt := `SELECT tags.name, COUNT(*) FROM tags
+	         JOIN snippet_tags ON snippet_tags.tag_id = tags.id
+	         JOIN snippets ON snippets.id = snippet_tags.snippet_id
+	         WHERE snippets.expires > UTC_TIMESTAMP() AND snippets.hidden = FALSE AND snippets.visibility = 'public'
+	         GROUP BY tags.id, tags.name
+	         ORDER BY COUNT(*) DESC, tags.name
+	         LIMIT ?`
+
+	rows, err := m.DB.Query(stmt, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*Tag{}
+
+	for rows.Next() {
+		t := &Tag{}
+
+		err = rows.Scan(&t.Name, &t.Count)
+		if err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// insertTags attaches the tags to a snippet, creating any tags which don't
+// exist yet.
+func insertTags(q queryer, snippetID int, tags []string) error {
+	for _, tag := range tags {
+		_, err := q.Exec(`INSERT IGNORE INTO tags (name) VALUES(?)`, tag)
+		if err != nil {
+			return err
+		}
+
+		stmt := `INSERT INTO snippet_tags (snippet_id, tag_id)
+		SELECT ?, id FROM tags WHERE name = ?`
+
+		_, err = q.Exec(stmt, snippetID, tag)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Hiwiii/snippetbox.git/internal/totp"
+)
+
+// Define a TwoFactorModel type which wraps a sql.DB connection pool. It
+// stores the TOTP secrets and recovery codes of users who have turned on
+// two-factor authentication.
+type TwoFactorModel struct {
+	DB *sql.DB
+}
+
+// Enable turns on two-factor authentication for a user with a secret which
+// the user has confirmed with the code for step. Any previous recovery codes
+// are replaced with the given hashes.
+func (m *TwoFactorModel) Enable(userID int, secret string, step int64, recoveryHashes [][]byte) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE users SET totp_secret = ?, totp_last_step = ? WHERE id = ?`, secret, step, userID)
+	if err != nil {
+		return err
+	}
+
+	err = insertRecoveryCodes(tx, userID, recoveryHashes)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Disable turns off two-factor authentication for a user and deletes their
+// recovery codes.
+func (m *TwoFactorModel) Disable(userID int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE users SET totp_secret = NULL, totp_last_step = -1 WHERE id = ?`, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertRecoveryCodes deletes the recovery codes of a user and stores the
+// given hashes instead.
+func insertRecoveryCodes(tx *sql.Tx, userID int, hashes [][]byte) error {
+	_, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range hashes {
+		_, err = tx.Exec(`INSERT INTO recovery_codes (user_id, code_hash) VALUES(?, ?)`, userID, hash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Verify checks a code from the user's authenticator app. Each code is only
+// accepted once: the step it belongs to is recorded, and only a conditional
+// update succeeds, so that two requests with the same code can't both pass.
+// It returns ErrNoRecord if the user hasn't turned on two-factor
+// authentication.
+func (m *TwoFactorModel) Verify(userID int, code string, now time.Time) (bool, error) {
+	var secret sql.NullString
+	var lastStep int64
+
+	stmt := `SELECT totp_secret, totp_last_step FROM users WHERE id = ?`
+
+	err := m.DB.QueryRow(stmt, userID).Scan(&secret, &lastStep)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, ErrNoRecord
+		}
+		return false, err
+	}
+	if !secret.Valid {
+		return false, ErrNoRecord
+	}
+
+	step, ok := totp.Validate(secret.String, code, now, lastStep)
+	if !ok {
+		return false, nil
+	}
+
+	result, err := m.DB.Exec(`UPDATE users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?`, step, userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows == 1, nil
+}
+
+// UseRecoveryCode checks a recovery code and, if it matches one of the
+// user's codes, deletes it so that it can't be used again.
+func (m *TwoFactorModel) UseRecoveryCode(userID int, code string) (bool, error) {
+	rows, err := m.DB.Query(`SELECT id, code_hash FROM recovery_codes WHERE user_id = ?`, userID)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	var hashes [][]byte
+
+	for rows.Next() {
+		var id int
+		var hash []byte
+
+		err = rows.Scan(&id, &hash)
+		if err != nil {
+			return false, err
+		}
+
+		ids = append(ids, id)
+		hashes = append(hashes, hash)
+	}
+
+	if err = rows.Err(); err != nil {
+		return false, err
+	}
+
+	i := totp.MatchRecoveryCode(code, hashes)
+	if i < 0 {
+		return false, nil
+	}
+
+	// Only the request which deletes the code may use it.
+	result, err := m.DB.Exec(`DELETE FROM recovery_codes WHERE id = ?`, ids[i])
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// RecoveryCodesLeft returns how many unused recovery codes a user has.
+func (m *TwoFactorModel) RecoveryCodesLeft(userID int) (int, error) {
+	var n int
+
+	err := m.DB.QueryRow(`SELECT COUNT(*) FROM recovery_codes WHERE user_id = ?`, userID).Scan(&n)
+	return n, err
+}
@@ -0,0 +1,331 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Role controls what a user may do. Each role includes the permissions of
+// the roles before it.
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// Roles lists the roles from least to most privileged.
+var Roles = []Role{RoleUser, RoleModerator, RoleAdmin}
+
+// AtLeast returns true if r includes the permissions of other. Unknown roles
+// have no permissions.
+func (r Role) AtLeast(other Role) bool {
+	rank := func(role Role) int {
+		for i, known := range Roles {
+			if role == known {
+				return i
+			}
+		}
+		return -1
+	}
+	return rank(r) >= 0 && rank(r) >= rank(other)
+}
+
+// User is a local account. Email is empty if the identity provider didn't
+// supply a verified address. Name is the display name shown on the user's
+// profile and comments, and Username names the profile in its URL.
+type User struct {
+	ID        int
+	Username  string
+	Name      string
+	Email     string
+	Bio       string
+	HasAvatar bool
+	TwoFactor bool // true if logging in needs a code from an authenticator app
+	Role      Role
+	Disabled  bool
+	Created   time.Time
+	LastLogin sql.NullTime
+}
+
+// UsernameRX matches a valid username: lowercase letters, digits and dashes.
+var UsernameRX = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// AvatarTypes lists the content types avatars can have.
+var AvatarTypes = []string{"image/png", "image/jpeg", "image/gif"}
+
+// IsModerator returns true if the user may moderate content.
+func (u *User) IsModerator() bool {
+	return u.Role.AtLeast(RoleModerator)
+}
+
+// IsAdmin returns true if the user may manage other users.
+func (u *User) IsAdmin() bool {
+	return u.Role.AtLeast(RoleAdmin)
+}
+
+// userColumns lists the columns read by scanUser().
+const userColumns = `id, username, name, email, bio, avatar_type IS NOT NULL, totp_secret IS NOT NULL, role, disabled, created, last_login`
+
+// scanUser copies the userColumns of a row into a new User struct.
+func scanUser(row rowScanner) (*User, error) {
+	u := &User{}
+	var email sql.NullString
+
+	err := row.Scan(&u.ID, &u.Username, &u.Name, &email, &u.Bio, &u.HasAvatar, &u.TwoFactor, &u.Role, &u.Disabled, &u.Created, &u.LastLogin)
+	if err != nil {
+		return nil, err
+	}
+	u.Email = email.String
+
+	return u, nil
+}
+
+// Define a UserModel type which wraps a sql.DB connection pool.
+type UserModel struct {
+	DB *sql.DB
+}
+
+// Get returns the user with the given ID.
+func (m *UserModel) Get(id int) (*User, error) {
+	stmt := `SELECT ` + userColumns + ` FROM users WHERE id = ?`
+
+	u, err := scanUser(m.DB.QueryRow(stmt, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// GetByUsername returns the user with the given username.
+func (m *UserModel) GetByUsername(username string) (*User, error) {
+	stmt := `SELECT ` + userColumns + ` FROM users WHERE username = ?`
+
+	u, err := scanUser(m.DB.QueryRow(stmt, username))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// Search returns up to 50 users, newest first, whose name, username or email
+// address contains q. An empty q matches every user.
+func (m *UserModel) Search(q string) ([]*User, error) {
+	stmt := `SELECT ` + userColumns + ` FROM users
+	         WHERE name LIKE ? OR username LIKE ? OR email LIKE ?
+	         ORDER BY id DESC
+	         LIMIT 50`
+
+	pattern := likePattern(q)
+
+	rows, err := m.DB.Query(stmt, pattern, pattern, pattern)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// LoginOIDC returns the ID of the user linked to an identity from an OpenID
+// Connect provider, and records the login. An unknown identity is linked to
+// the user with the same email address, if there is one, and otherwise to a
+// new user. email must only be passed if the provider verified it, since it
+// is trusted for linking; pass "" otherwise.
+func (m *UserModel) LoginOIDC(issuer, subject, name, email string) (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int
+
+	stmt := `SELECT user_id FROM user_identities WHERE issuer = ? AND subject = ?`
+
+	err = tx.QueryRow(stmt, issuer, subject).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		id, err = linkIdentity(tx, issuer, subject, name, email)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`UPDATE users SET last_login = UTC_TIMESTAMP() WHERE id = ?`, id)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// linkIdentity links a new identity to the user with the given email address,
+// creating the user if necessary, and returns the user's ID.
+func linkIdentity(tx *sql.Tx, issuer, subject, name, email string) (int, error) {
+	var id int
+	err := sql.ErrNoRows
+
+	if email != "" {
+		err = tx.QueryRow(`SELECT id FROM users WHERE email = ?`, email).Scan(&id)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		var username string
+		username, err = freeUsername(tx, UsernameFrom(name, email))
+		if err != nil {
+			return 0, err
+		}
+
+		stmt := `INSERT INTO users (username, name, email, created) VALUES(?, ?, ?, UTC_TIMESTAMP())`
+
+		var result sql.Result
+		result, err = tx.Exec(stmt, username, name, sql.NullString{String: email, Valid: email != ""})
+		if err != nil {
+			return 0, err
+		}
+
+		var lastID int64
+		lastID, err = result.LastInsertId()
+		id = int(lastID)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	stmt := `INSERT INTO user_identities (issuer, subject, user_id, created) VALUES(?, ?, ?, UTC_TIMESTAMP())`
+
+	_, err = tx.Exec(stmt, issuer, subject, id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// UsernameFrom suggests a username for a new user, based on the local part
+// of their email address or else their name, such as "jane-doe" for "Jane
+// Doe". It returns "user" if neither has any letters or digits.
+func UsernameFrom(name, email string) string {
+	source := name
+	if local, _, ok := strings.Cut(email, "@"); ok && local != "" {
+		source = local
+	}
+
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(source) {
+		switch {
+		case r >= 'a' && r <= 'z' || r >= '0' && r <= '9':
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		default:
+			dash = true
+		}
+		if b.Len() >= 30 {
+			break
+		}
+	}
+
+	if b.Len() == 0 {
+		return "user"
+	}
+	return b.String()
+}
+
+// freeUsername returns base, or base with a number appended if another user
+// already has it.
+func freeUsername(tx *sql.Tx, base string) (string, error) {
+	username := base
+	for n := 2; ; n++ {
+		var taken bool
+		err := tx.QueryRow(`SELECT EXISTS(SELECT true FROM users WHERE username = ?)`, username).Scan(&taken)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return username, nil
+		}
+		username = fmt.Sprintf("%s-%d", base, n)
+	}
+}
+
+// UpdateProfile changes the display name and bio of a user.
+func (m *UserModel) UpdateProfile(id int, name, bio string) error {
+	_, err := m.DB.Exec(`UPDATE users SET name = ?, bio = ? WHERE id = ?`, name, bio, id)
+	return err
+}
+
+// SetAvatar replaces the avatar of a user. A nil image removes it.
+func (m *UserModel) SetAvatar(id int, image []byte, contentType string) error {
+	stmt := `UPDATE users SET avatar = ?, avatar_type = ? WHERE id = ?`
+
+	_, err := m.DB.Exec(stmt, image, sql.NullString{String: contentType, Valid: image != nil}, id)
+	return err
+}
+
+// Avatar returns the avatar image of a user and its content type. It returns
+// ErrNoRecord if the user doesn't exist or has no avatar.
+func (m *UserModel) Avatar(username string) ([]byte, string, error) {
+	var image []byte
+	var contentType string
+
+	stmt := `SELECT avatar, avatar_type FROM users WHERE username = ? AND avatar IS NOT NULL`
+
+	err := m.DB.QueryRow(stmt, username).Scan(&image, &contentType)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, "", ErrNoRecord
+		}
+		return nil, "", err
+	}
+
+	return image, contentType, nil
+}
+
+// SetRole changes the role of a user.
+func (m *UserModel) SetRole(id int, role Role) error {
+	_, err := m.DB.Exec(`UPDATE users SET role = ? WHERE id = ?`, role, id)
+	return err
+}
+
+// SetDisabled disables or re-enables a user's account. Disabled users can't
+// log in and are logged out of existing sessions.
+func (m *UserModel) SetDisabled(id int, disabled bool) error {
+	_, err := m.DB.Exec(`UPDATE users SET disabled = ? WHERE id = ?`, disabled, id)
+	return err
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRoleAtLeast(t *testing.T) {
+	tests := []struct {
+		role, other Role
+		want        bool
+	}{
+		{RoleAdmin, RoleModerator, true},
+		{RoleModerator, RoleModerator, true},
+		{RoleUser, RoleModerator, false},
+		{RoleModerator, RoleAdmin, false},
+		{Role("root"), RoleUser, false},
+		{Role(""), RoleUser, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.role.AtLeast(tt.other); got != tt.want {
+			t.Errorf("%q.AtLeast(%q) = %v; want %v", tt.role, tt.other, got, tt.want)
+		}
+	}
+}
+
+func TestUsernameFrom(t *testing.T) {
+	tests := []struct {
+		name, email string
+		want        string
+	}{
+		{"Jane Doe", "", "jane-doe"},
+		{"Jane Doe", "j.doe+work@example.com", "j-doe-work"},
+		{"  Émile   Zola!", "", "mile-zola"},
+		{"日本", "", "user"},
+		{"", "@example.com", "user"},
+		{strings.Repeat("ab ", 20), "", "ab-ab-ab-ab-ab-ab-ab-ab-ab-ab-a"},
+	}
+
+	for _, tt := range tests {
+		got := UsernameFrom(tt.name, tt.email)
+		if got != tt.want {
+			t.Errorf("UsernameFrom(%q, %q) = %q; want %q", tt.name, tt.email, got, tt.want)
+		}
+		if !UsernameRX.MatchString(got) {
+			t.Errorf("UsernameFrom(%q, %q) = %q, which isn't a valid username", tt.name, tt.email, got)
+		}
+	}
+}
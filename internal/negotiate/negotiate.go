@@ -0,0 +1,109 @@
+package negotiate
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Encoding returns the content coding from offers that the Accept-Encoding
+// header prefers, or "" if none of them is acceptable. Offers are in the
+// server's order of preference, which breaks ties between equal quality
+// values. A coding the header doesn't mention is only acceptable through a
+// "*" entry, and "q=0" rules a coding out.
+func Encoding(header string, offers ...string) string {
+	weights := parse(header)
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		q, ok := weights[offer]
+		if !ok {
+			q = weights["*"]
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+
+	return best
+}
+
+// Language returns the language tag from offers that the Accept-Language
+// header prefers, or "" if none of them is acceptable. A range in the header
+// matches an offer with the same tag, a more specific one ("de" matches
+// "de-AT") or, failing those, a less specific one ("de-AT" matches "de"). As
+// with Encoding, ties go to the earlier offer.
+func Language(header string, offers ...string) string {
+	weights := parse(header)
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		tag := strings.ToLower(offer)
+
+		q, ok := weights[tag]
+		if !ok {
+			q, ok = prefixWeight(weights, tag)
+		}
+		if !ok {
+			q = weights["*"]
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+
+	return best
+}
+
+// prefixWeight returns the highest quality value of the ranges that are a
+// prefix of tag, or else of those tag is a prefix of.
+func prefixWeight(weights map[string]float64, tag string) (float64, bool) {
+	q, found := 0.0, false
+	for _, less := range []bool{true, false} {
+		for r, w := range weights {
+			prefix, full := r, tag
+			if !less {
+				prefix, full = tag, r
+			}
+			if strings.HasPrefix(full, prefix+"-") && (!found || w > q) {
+				q, found = w, true
+			}
+		}
+		if found {
+			return q, true
+		}
+	}
+	return 0, false
+}
+
+// parse returns the quality value of each entry in an Accept-* header, keyed
+// by the lowercased value.
+func parse(header string) map[string]float64 {
+	weights := make(map[string]float64)
+
+	for _, part := range strings.Split(header, ",") {
+		value, params, _ := strings.Cut(part, ";")
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(name, "q") {
+				parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+				if err != nil || parsed < 0 || parsed > 1 {
+					parsed = 0
+				}
+				q = parsed
+			}
+		}
+
+		// Keep the first entry for a repeated value.
+		if _, ok := weights[value]; !ok {
+			weights[value] = q
+		}
+	}
+
+	return weights
+}
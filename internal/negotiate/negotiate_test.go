@@ -0,0 +1,62 @@
+package negotiate
+
+import "testing"
+
+func TestEncoding(t *testing.T) {
+	offers := []string{"br", "zstd", "gzip"}
+
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate, br, zstd", "br"},
+		{"GZIP", "gzip"},
+		{"gzip;q=1.0, br;q=0.5", "gzip"},
+		{"br;q=0, gzip", "gzip"},
+		{"br; q=0 , zstd ; q=0.8, gzip;q=0.8", "zstd"},
+		{"*", "br"},
+		{"*;q=0.5, br;q=0", "zstd"},
+		{"*;q=0", ""},
+		{"gzip;q=0", ""},
+		{"gzip;q=abc, zstd", "zstd"},
+		{"gzip;q=2", ""},
+		{"compress, deflate", ""},
+		{" , ,gzip", "gzip"},
+	}
+
+	for _, tt := range tests {
+		if got := Encoding(tt.header, offers...); got != tt.want {
+			t.Errorf("Encoding(%q) = %q; want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestLanguage(t *testing.T) {
+	offers := []string{"en", "de", "fr-CA"}
+
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"de", "de"},
+		{"de-DE,de;q=0.9,en;q=0.8", "de"},
+		{"de-AT", "de"},
+		{"fr", "fr-CA"},
+		{"fr-ca;q=0.9, de;q=0.5", "fr-CA"},
+		{"en-GB;q=0.5, de;q=0.7", "de"},
+		{"de;q=0, de-CH", ""},
+		{"it, *;q=0.1", "en"},
+		{"it, nl", ""},
+		{"en;q=0.5, de;q=0.5", "en"},
+	}
+
+	for _, tt := range tests {
+		if got := Language(tt.header, offers...); got != tt.want {
+			t.Errorf("Language(%q) = %q; want %q", tt.header, got, tt.want)
+		}
+	}
+}
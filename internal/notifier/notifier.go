@@ -0,0 +1,137 @@
+package notifier
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io/fs"
+	"log"
+	"time"
+
+	"github.com/Hiwiii/snippetbox.git/internal/audit"
+	"github.com/Hiwiii/snippetbox.git/internal/mailer"
+	"github.com/Hiwiii/snippetbox.git/internal/models"
+)
+
+// SnippetStore is the part of models.SnippetModel used by the notifier.
+type SnippetStore interface {
+	DueForNotification(now, before time.Time) ([]*models.Snippet, error)
+	ClaimNotification(id int, token string) (bool, error)
+	ReleaseNotification(id int) error
+}
+
+// ExpiryNotifier emails the creators of snippets which are about to expire, if
+// they asked for it when creating the snippet. Each snippet gets at most one
+// reminder, which links to a page where the snippet's expiry can be extended.
+type ExpiryNotifier struct {
+	Snippets  SnippetStore
+	Mailer    mailer.Mailer
+	Templates fs.FS         // contains expiry.tmpl
+	BaseURL   string        // used to build links, e.g. "https://localhost:4000"
+	Before    time.Duration // how long before expiry the reminder is sent
+	Now       func() time.Time
+	ErrorLog  *log.Logger
+	Auditor   *audit.Auditor // records the management tokens sent out
+}
+
+// expiryMail is the data passed to the expiry.tmpl email template.
+type expiryMail struct {
+	Snippet   *models.Snippet
+	ViewURL   string
+	ManageURL string
+}
+
+// NotifyDue sends reminders for every snippet expiring within the notice
+// period. A reminder which can't be sent is released, so it is tried again on
+// the next run; the first error is returned after all snippets are processed.
+func (n *ExpiryNotifier) NotifyDue() error {
+	now := n.Now()
+
+	snippets, err := n.Snippets.DueForNotification(now, now.Add(n.Before))
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+
+	for _, s := range snippets {
+		err = n.notify(s)
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("notifying snippet %d: %w", s.ID, err)
+		}
+	}
+
+	return firstErr
+}
+
+// notify claims and sends the reminder for a single snippet.
+func (n *ExpiryNotifier) notify(s *models.Snippet) error {
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	claimed, err := n.Snippets.ClaimNotification(s.ID, token)
+	if err != nil || !claimed {
+		return err
+	}
+
+	msg, err := mailer.NewMessage(n.Templates, "expiry.tmpl", s.NotifyEmail, expiryMail{
+		Snippet:   s,
+		ViewURL:   fmt.Sprintf("%s/snippet/view/%d", n.BaseURL, s.ID),
+		ManageURL: fmt.Sprintf("%s/snippet/manage/%d?token=%s", n.BaseURL, s.ID, token),
+	})
+	if err == nil {
+		err = n.Mailer.Send(msg)
+	}
+	if err != nil {
+		if releaseErr := n.Snippets.ReleaseNotification(s.ID); releaseErr != nil {
+			n.ErrorLog.Printf("releasing notification for snippet %d: %v", s.ID, releaseErr)
+		}
+		return err
+	}
+
+	// The token is only recorded once it has been sent, since a released
+	// claim is never usable.
+	err = n.Auditor.Record(&models.AuditEvent{
+		Action:  models.AuditTokenCreate,
+		Target:  audit.Snippet(s.ID),
+		Details: "expiry reminder link emailed to the creator",
+	})
+	if err != nil {
+		n.ErrorLog.Printf("auditing notification for snippet %d: %v", s.ID, err)
+	}
+
+	return nil
+}
+
+// Run calls NotifyDue every interval until the context is cancelled, logging
+// any errors.
+func (n *ExpiryNotifier) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := n.NotifyDue()
+		if err != nil {
+			n.ErrorLog.Print(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// newToken returns a random URL-safe token.
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
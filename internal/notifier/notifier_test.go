@@ -0,0 +1,139 @@
+package notifier
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Hiwiii/snippetbox.git/internal/mailer"
+	"github.com/Hiwiii/snippetbox.git/internal/models"
+)
+
+// fakeStore keeps snippets in memory and mimics the claim semantics of
+// models.SnippetModel.
+type fakeStore struct {
+	snippets []*models.Snippet
+	notified map[int]string
+}
+
+func (s *fakeStore) DueForNotification(now, before time.Time) ([]*models.Snippet, error) {
+	var due []*models.Snippet
+	for _, sn := range s.snippets {
+		if _, ok := s.notified[sn.ID]; !ok && sn.Expires.After(now) && !sn.Expires.After(before) {
+			due = append(due, sn)
+		}
+	}
+	return due, nil
+}
+
+func (s *fakeStore) ClaimNotification(id int, token string) (bool, error) {
+	if _, ok := s.notified[id]; ok {
+		return false, nil
+	}
+	s.notified[id] = token
+	return true, nil
+}
+
+func (s *fakeStore) ReleaseNotification(id int) error {
+	delete(s.notified, id)
+	return nil
+}
+
+type recordingMailer struct {
+	sent []*mailer.Message
+	err  error
+}
+
+func (m *recordingMailer) Send(msg *mailer.Message) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func newTestNotifier(store *fakeStore, m *recordingMailer, now time.Time) *ExpiryNotifier {
+	return &ExpiryNotifier{
+		Snippets:  store,
+		Mailer:    m,
+		Templates: os.DirFS("../../ui/mail"),
+		BaseURL:   "https://example.com",
+		Before:    24 * time.Hour,
+		Now:       func() time.Time { return now },
+		ErrorLog:  log.New(io.Discard, "", 0),
+	}
+}
+
+func TestNotifyDue(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	store := &fakeStore{
+		snippets: []*models.Snippet{
+			{ID: 1, Title: "Soon", Expires: now.Add(2 * time.Hour), NotifyEmail: "a@example.com"},
+			{ID: 2, Title: "Later", Expires: now.Add(72 * time.Hour), NotifyEmail: "b@example.com"},
+		},
+		notified: map[int]string{},
+	}
+	m := &recordingMailer{}
+	n := newTestNotifier(store, m, now)
+
+	for i := 0; i < 2; i++ {
+		err := n.NotifyDue()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(m.sent) != 1 {
+		t.Fatalf("sent %d messages; want 1", len(m.sent))
+	}
+
+	msg := m.sent[0]
+	if msg.To != "a@example.com" {
+		t.Errorf("To = %q; want %q", msg.To, "a@example.com")
+	}
+	if !strings.Contains(msg.Subject, "Soon") {
+		t.Errorf("Subject = %q; want it to contain the title", msg.Subject)
+	}
+
+	link := "https://example.com/snippet/manage/1?token=" + store.notified[1]
+	for _, body := range []string{msg.TextBody, msg.HTMLBody} {
+		if !strings.Contains(body, link) {
+			t.Errorf("body does not contain the extension link %q:\n%s", link, body)
+		}
+	}
+}
+
+func TestNotifyDueReleasesOnFailure(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	store := &fakeStore{
+		snippets: []*models.Snippet{
+			{ID: 1, Title: "Soon", Expires: now.Add(time.Hour), NotifyEmail: "a@example.com"},
+		},
+		notified: map[int]string{},
+	}
+	m := &recordingMailer{err: errors.New("connection refused")}
+	n := newTestNotifier(store, m, now)
+
+	err := n.NotifyDue()
+	if err == nil {
+		t.Fatal("got nil error; want the send error")
+	}
+	if _, ok := store.notified[1]; ok {
+		t.Fatal("notification still claimed after failed send")
+	}
+
+	m.err = nil
+	err = n.NotifyDue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.sent) != 1 {
+		t.Errorf("sent %d messages on retry; want 1", len(m.sent))
+	}
+}
@@ -0,0 +1,269 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrInvalidToken = errors.New("oidc: invalid ID token")
+
+// leeway allows for clock drift between us and the identity provider.
+const leeway = time.Minute
+
+// claims are the ID token claims we check or use.
+type claims struct {
+	Issuer        string    `json:"iss"`
+	Subject       string    `json:"sub"`
+	Audience      audience  `json:"aud"`
+	AuthorizedBy  string    `json:"azp"`
+	Expiry        int64     `json:"exp"`
+	IssuedAt      int64     `json:"iat"`
+	Nonce         string    `json:"nonce"`
+	Email         string    `json:"email"`
+	EmailVerified boolClaim `json:"email_verified"`
+	Name          string    `json:"name"`
+}
+
+// audience accepts the aud claim as either a string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		*a = audience{s}
+		return nil
+	}
+	var list []string
+	err := json.Unmarshal(b, &list)
+	*a = list
+	return err
+}
+
+// boolClaim accepts true as well as "true", which some providers send.
+type boolClaim bool
+
+func (c *boolClaim) UnmarshalJSON(b []byte) error {
+	*c = boolClaim(string(b) == "true" || string(b) == `"true"`)
+	return nil
+}
+
+// verify checks the signature and claims of a raw ID token.
+func (p *Provider) verify(ctx context.Context, rawIDToken, nonce string) (*Identity, error) {
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidToken)
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	err := decodeSegment(parts[0], &header)
+	if err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", ErrInvalidToken, err)
+	}
+
+	key, err := p.keys.get(ctx, header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = verifySignature(header.Algorithm, key, parts[0]+"."+parts[1], signature)
+	if err != nil {
+		return nil, err
+	}
+
+	var c claims
+	err = decodeSegment(parts[1], &c)
+	if err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrInvalidToken, err)
+	}
+
+	now := p.config.Now()
+
+	switch {
+	case strings.TrimSuffix(c.Issuer, "/") != p.config.Issuer:
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, c.Issuer)
+	case !c.Audience.contains(p.config.ClientID):
+		return nil, fmt.Errorf("%w: not issued for this client", ErrInvalidToken)
+	case len(c.Audience) > 1 && c.AuthorizedBy != p.config.ClientID:
+		return nil, fmt.Errorf("%w: authorized party is not this client", ErrInvalidToken)
+	case c.Expiry == 0 || now.After(time.Unix(c.Expiry, 0).Add(leeway)):
+		return nil, fmt.Errorf("%w: expired", ErrInvalidToken)
+	case time.Unix(c.IssuedAt, 0).After(now.Add(leeway)):
+		return nil, fmt.Errorf("%w: issued in the future", ErrInvalidToken)
+	case c.Nonce == "" || subtle.ConstantTimeCompare([]byte(c.Nonce), []byte(nonce)) != 1:
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	case c.Subject == "":
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	}
+
+	return &Identity{
+		Issuer:        p.config.Issuer,
+		Subject:       c.Subject,
+		Email:         c.Email,
+		EmailVerified: bool(c.EmailVerified),
+		Name:          c.Name,
+	}, nil
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// verifySignature checks a JWS signature. Only RS256 and ES256 are accepted;
+// in particular "none" and HMAC algorithms are rejected.
+func verifySignature(alg string, key any, signed string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+
+	switch alg {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if ok && rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) == nil {
+			return nil
+		}
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if ok && len(signature) == 64 {
+			r := new(big.Int).SetBytes(signature[:32])
+			s := new(big.Int).SetBytes(signature[32:])
+			if ecdsa.Verify(pub, digest[:], r, s) {
+				return nil
+			}
+		}
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, alg)
+	}
+
+	return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+}
+
+// decodeSegment decodes a base64url JSON segment of a JWT.
+func decodeSegment(seg string, dst any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, dst)
+}
+
+// keySet caches the provider's signing keys, refetching them when a token is
+// signed with an unknown key ID, at most once a minute.
+type keySet struct {
+	url    string
+	client *http.Client
+	now    func() time.Time
+
+	mu      sync.Mutex
+	keys    map[string]any
+	fetched time.Time
+}
+
+// get returns the key with the given ID.
+func (ks *keySet) get(ctx context.Context, kid string) (any, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if key, ok := ks.keys[kid]; ok {
+		return key, nil
+	}
+
+	if ks.keys != nil && ks.now().Sub(ks.fetched) < time.Minute {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, kid)
+	}
+
+	keys, err := fetchKeys(ctx, ks.client, ks.url)
+	if err != nil {
+		return nil, err
+	}
+	ks.keys = keys
+	ks.fetched = ks.now()
+
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, kid)
+	}
+	return key, nil
+}
+
+// fetchKeys downloads a JWKS document and parses its RSA and P-256 signing
+// keys. Keys of other types are skipped.
+func fetchKeys(ctx context.Context, client *http.Client, url string) (map[string]any, error) {
+	var jwks struct {
+		Keys []struct {
+			KeyType string `json:"kty"`
+			KeyID   string `json:"kid"`
+			Use     string `json:"use"`
+			N       string `json:"n"`
+			E       string `json:"e"`
+			Curve   string `json:"crv"`
+			X       string `json:"x"`
+			Y       string `json:"y"`
+		} `json:"keys"`
+	}
+
+	err := getJSON(ctx, client, url, &jwks)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: fetching keys: %w", err)
+	}
+
+	keys := make(map[string]any)
+
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		switch k.KeyType {
+		case "RSA":
+			n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+			e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+			if err1 != nil || err2 != nil || len(e) > 4 {
+				continue
+			}
+			keys[k.KeyID] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case "EC":
+			x, err1 := base64.RawURLEncoding.DecodeString(k.X)
+			y, err2 := base64.RawURLEncoding.DecodeString(k.Y)
+			if k.Curve != "P-256" || err1 != nil || err2 != nil || len(x) != 32 || len(y) != 32 {
+				continue
+			}
+			// Parsing the uncompressed point checks that it is on the curve.
+			_, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...))
+			if err != nil {
+				continue
+			}
+			keys[k.KeyID] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+
+	return keys, nil
+}
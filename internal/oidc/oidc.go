@@ -0,0 +1,252 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	ErrStateMismatch    = errors.New("oidc: state mismatch")
+	ErrDomainNotAllowed = errors.New("oidc: email domain not allowed")
+)
+
+// maxResponseSize limits how much of a response from the identity provider is read.
+const maxResponseSize = 1 << 20
+
+// Config holds the settings for an OpenID Connect identity provider.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// AllowedDomains, if not empty, restricts logins to users with a verified
+	// email address in one of these domains.
+	AllowedDomains []string
+	// HTTPClient is used to talk to the identity provider. It defaults to a
+	// client with a 10 second timeout.
+	HTTPClient *http.Client
+	// Now defaults to time.Now.
+	Now func() time.Time
+}
+
+// Provider performs the authorization code flow against an identity provider.
+type Provider struct {
+	config        Config
+	authURL       string
+	tokenURL      string
+	jwksURL       string
+	keys          *keySet
+	allowedDomain map[string]bool
+}
+
+// Identity is the verified identity of a user who logged in.
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// AuthRequest holds the per-login secrets which must be kept, usually in the
+// session, between redirecting to the identity provider and the callback.
+type AuthRequest struct {
+	State    string
+	Nonce    string
+	Verifier string // PKCE code verifier
+}
+
+// New fetches the provider's discovery document and returns a Provider.
+func New(ctx context.Context, cfg Config) (*Provider, error) {
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+
+	var discovery struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+
+	err := getJSON(ctx, cfg.HTTPClient, cfg.Issuer+"/.well-known/openid-configuration", &discovery)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: discovery: %w", err)
+	}
+
+	// The discovery document must be for the configured issuer, otherwise ID
+	// tokens from it would fail the issuer check anyway.
+	if strings.TrimSuffix(discovery.Issuer, "/") != cfg.Issuer {
+		return nil, fmt.Errorf("oidc: discovery issuer %q does not match %q", discovery.Issuer, cfg.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("oidc: discovery document is missing endpoints")
+	}
+
+	p := &Provider{
+		config:        cfg,
+		authURL:       discovery.AuthorizationEndpoint,
+		tokenURL:      discovery.TokenEndpoint,
+		jwksURL:       discovery.JWKSURI,
+		allowedDomain: make(map[string]bool),
+	}
+	p.keys = &keySet{url: p.jwksURL, client: cfg.HTTPClient, now: cfg.Now}
+
+	for _, d := range cfg.AllowedDomains {
+		p.allowedDomain[strings.ToLower(strings.TrimSpace(d))] = true
+	}
+
+	return p, nil
+}
+
+// NewAuthRequest generates a random state, nonce and PKCE verifier.
+func NewAuthRequest() (*AuthRequest, error) {
+	var values [3]string
+	for i := range values {
+		b := make([]byte, 32)
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(b)
+	}
+	return &AuthRequest{State: values[0], Nonce: values[1], Verifier: values[2]}, nil
+}
+
+// AuthCodeURL returns the URL to redirect the user to in order to log in.
+func (p *Provider) AuthCodeURL(req *AuthRequest) string {
+	challenge := sha256.Sum256([]byte(req.Verifier))
+
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.config.ClientID)
+	v.Set("redirect_uri", p.config.RedirectURL)
+	v.Set("scope", "openid email profile")
+	v.Set("state", req.State)
+	v.Set("nonce", req.Nonce)
+	v.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	v.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(p.authURL, "?") {
+		sep = "&"
+	}
+	return p.authURL + sep + v.Encode()
+}
+
+// Callback handles the query of the redirect back from the identity
+// provider: it checks the state, exchanges the code for an ID token, verifies
+// the token and applies the domain allow-list.
+func (p *Provider) Callback(ctx context.Context, query url.Values, req *AuthRequest) (*Identity, error) {
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(req.State)) != 1 || req.State == "" {
+		return nil, ErrStateMismatch
+	}
+	if e := query.Get("error"); e != "" {
+		return nil, fmt.Errorf("oidc: authorization failed: %s", e)
+	}
+
+	rawIDToken, err := p.exchange(ctx, query.Get("code"), req.Verifier)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := p.verify(ctx, rawIDToken, req.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(p.allowedDomain) > 0 {
+		_, domain, _ := strings.Cut(id.Email, "@")
+		if !id.EmailVerified || !p.allowedDomain[strings.ToLower(domain)] {
+			return nil, ErrDomainNotAllowed
+		}
+	}
+
+	return id, nil
+}
+
+// exchange redeems the authorization code at the token endpoint and returns
+// the raw ID token.
+func (p *Provider) exchange(ctx context.Context, code, verifier string) (string, error) {
+	if code == "" {
+		return "", errors.New("oidc: missing authorization code")
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("code_verifier", verifier)
+	form.Set("client_id", p.config.ClientID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.config.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("oidc: token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&token)
+	if err != nil && resp.StatusCode == http.StatusOK {
+		return "", fmt.Errorf("oidc: token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("oidc: token request failed with status %d: %s %s", resp.StatusCode, token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return "", errors.New("oidc: token response has no id_token")
+	}
+
+	return token.IDToken, nil
+}
+
+// getJSON fetches a URL and decodes the JSON response into dst.
+func getJSON(ctx context.Context, client *http.Client, url string, dst any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", url, resp.StatusCode)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(dst)
+}
@@ -0,0 +1,379 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testClientID     = "snippetbox"
+	testClientSecret = "s3cret"
+	testRedirectURL  = "https://snippetbox.example.com/user/login/oidc/callback"
+)
+
+var testNow = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// testIDP is a minimal identity provider. Codes are issued by authorize, which
+// stands in for the user logging in on the provider's login page.
+type testIDP struct {
+	server *httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+
+	mu    sync.Mutex
+	kid   string // key ID used to sign tokens, "rsa" or "ec"
+	codes map[string]url.Values
+	next  int
+	// claims are modified by tests before a code is redeemed.
+	claims func(c map[string]any)
+	// sign can replace the signing of the ID token.
+	sign func(header, payload string) string
+}
+
+func newTestIDP(t *testing.T) *testIDP {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &testIDP{rsaKey: rsaKey, ecKey: ecKey, kid: "rsa", codes: map[string]url.Values{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", idp.jwks)
+	mux.HandleFunc("/token", idp.token)
+
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	return idp
+}
+
+// authorize returns the callback query for a successful login after the user
+// was sent to authURL.
+func (idp *testIDP) authorize(t *testing.T, authURL string) url.Values {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(authURL, idp.server.URL+"/authorize?") {
+		t.Fatalf("auth URL %s is not on the provider", authURL)
+	}
+
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("client_id") != testClientID || q.Get("redirect_uri") != testRedirectURL {
+		t.Fatalf("unexpected auth request %v", q)
+	}
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	idp.next++
+	code := fmt.Sprintf("code-%d", idp.next)
+	idp.codes[code] = q
+
+	return url.Values{"code": {code}, "state": {q.Get("state")}}
+}
+
+func (idp *testIDP) jwks(w http.ResponseWriter, r *http.Request) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	json.NewEncoder(w).Encode(map[string]any{
+		"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa", "use": "sig", "n": b64(idp.rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(idp.rsaKey.E)).Bytes())},
+			{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(idp.ecKey.X.FillBytes(make([]byte, 32))), "y": b64(idp.ecKey.Y.FillBytes(make([]byte, 32)))},
+			{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+		},
+	})
+}
+
+func (idp *testIDP) token(w http.ResponseWriter, r *http.Request) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	fail := func(msg string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": msg})
+	}
+
+	id, secret, ok := r.BasicAuth()
+	if !ok || id != testClientID || secret != testClientSecret {
+		fail("bad client credentials")
+		return
+	}
+
+	r.ParseForm()
+	auth, ok := idp.codes[r.PostForm.Get("code")]
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("redirect_uri") != auth.Get("redirect_uri") {
+		fail("unknown code")
+		return
+	}
+	delete(idp.codes, r.PostForm.Get("code"))
+
+	challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(challenge[:]) != auth.Get("code_challenge") {
+		fail("PKCE verification failed")
+		return
+	}
+
+	claims := map[string]any{
+		"iss":            idp.server.URL,
+		"sub":            "user-1",
+		"aud":            testClientID,
+		"exp":            testNow.Add(time.Hour).Unix(),
+		"iat":            testNow.Unix(),
+		"nonce":          auth.Get("nonce"),
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"name":           "Alice",
+	}
+	if idp.claims != nil {
+		idp.claims(claims)
+	}
+
+	alg := "RS256"
+	if idp.kid == "ec" {
+		alg = "ES256"
+	}
+	header := encodeJSON(map[string]string{"alg": alg, "kid": idp.kid, "typ": "JWT"})
+	payload := encodeJSON(claims)
+
+	var idToken string
+	if idp.sign != nil {
+		idToken = idp.sign(header, payload)
+	} else {
+		idToken = header + "." + payload + "." + idp.signature(header+"."+payload)
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "token_type": "Bearer", "id_token": idToken})
+}
+
+func (idp *testIDP) signature(signed string) string {
+	digest := sha256.Sum256([]byte(signed))
+
+	if idp.kid == "ec" {
+		r, s, err := ecdsa.Sign(rand.Reader, idp.ecKey, digest[:])
+		if err != nil {
+			panic(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...))
+	}
+
+	sig, err := rsa.SignPKCS1v15(rand.Reader, idp.rsaKey, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func encodeJSON(v any) string {
+	b, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func newTestProvider(t *testing.T, idp *testIDP, allowedDomains ...string) *Provider {
+	p, err := New(context.Background(), Config{
+		Issuer:         idp.server.URL,
+		ClientID:       testClientID,
+		ClientSecret:   testClientSecret,
+		RedirectURL:    testRedirectURL,
+		AllowedDomains: allowedDomains,
+		Now:            func() time.Time { return testNow },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// login runs the whole flow and returns the result of the callback.
+func login(t *testing.T, idp *testIDP, p *Provider, tamper func(req *AuthRequest, query url.Values)) (*Identity, error) {
+	req, err := NewAuthRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := idp.authorize(t, p.AuthCodeURL(req))
+	if tamper != nil {
+		tamper(req, query)
+	}
+
+	return p.Callback(context.Background(), query, req)
+}
+
+func TestLogin(t *testing.T) {
+	idp := newTestIDP(t)
+	p := newTestProvider(t, idp)
+
+	for _, kid := range []string{"rsa", "ec"} {
+		idp.kid = kid
+
+		id, err := login(t, idp, p, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", kid, err)
+		}
+
+		want := Identity{Issuer: idp.server.URL, Subject: "user-1", Email: "alice@example.com", EmailVerified: true, Name: "Alice"}
+		if *id != want {
+			t.Errorf("%s: got %+v; want %+v", kid, *id, want)
+		}
+	}
+}
+
+func TestLoginRejected(t *testing.T) {
+	idp := newTestIDP(t)
+	p := newTestProvider(t, idp)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(req *AuthRequest, query url.Values)
+		claims func(c map[string]any)
+		sign   func(header, payload string) string
+		want   error
+	}{
+		{
+			name:   "state mismatch",
+			tamper: func(req *AuthRequest, query url.Values) { query.Set("state", "forged") },
+			want:   ErrStateMismatch,
+		},
+		{
+			name:   "PKCE verifier mismatch",
+			tamper: func(req *AuthRequest, query url.Values) { req.Verifier = "forged" },
+		},
+		{
+			name:   "provider error",
+			tamper: func(req *AuthRequest, query url.Values) { query.Set("error", "access_denied") },
+		},
+		{
+			name:   "nonce mismatch",
+			tamper: func(req *AuthRequest, query url.Values) { req.Nonce = "forged" },
+			want:   ErrInvalidToken,
+		},
+		{
+			name:   "wrong audience",
+			claims: func(c map[string]any) { c["aud"] = "someone-else" },
+			want:   ErrInvalidToken,
+		},
+		{
+			name:   "multiple audiences without azp",
+			claims: func(c map[string]any) { c["aud"] = []string{testClientID, "someone-else"} },
+			want:   ErrInvalidToken,
+		},
+		{
+			name:   "wrong issuer",
+			claims: func(c map[string]any) { c["iss"] = "https://evil.example.com" },
+			want:   ErrInvalidToken,
+		},
+		{
+			name:   "expired",
+			claims: func(c map[string]any) { c["exp"] = testNow.Add(-2 * time.Minute).Unix() },
+			want:   ErrInvalidToken,
+		},
+		{
+			name: "signed with another key",
+			sign: func(header, payload string) string {
+				digest := sha256.Sum256([]byte(header + "." + payload))
+				sig, _ := rsa.SignPKCS1v15(rand.Reader, otherKey, crypto.SHA256, digest[:])
+				return header + "." + payload + "." + base64.RawURLEncoding.EncodeToString(sig)
+			},
+			want: ErrInvalidToken,
+		},
+		{
+			name: "alg none",
+			sign: func(header, payload string) string {
+				return encodeJSON(map[string]string{"alg": "none", "kid": "rsa"}) + "." + payload + "."
+			},
+			want: ErrInvalidToken,
+		},
+		{
+			name: "unknown key",
+			sign: func(header, payload string) string {
+				return encodeJSON(map[string]string{"alg": "RS256", "kid": "missing"}) + "." + payload + ".c2ln"
+			},
+			want: ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp.claims = tt.claims
+			idp.sign = tt.sign
+			defer func() { idp.claims, idp.sign = nil, nil }()
+
+			_, err := login(t, idp, p, tt.tamper)
+			if err == nil {
+				t.Fatal("login succeeded")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("got %v; want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowedDomains(t *testing.T) {
+	idp := newTestIDP(t)
+	p := newTestProvider(t, idp, "Example.com")
+
+	_, err := login(t, idp, p, nil)
+	if err != nil {
+		t.Fatalf("allowed domain rejected: %v", err)
+	}
+
+	idp.claims = func(c map[string]any) { c["email"] = "mallory@evil.com" }
+	_, err = login(t, idp, p, nil)
+	if !errors.Is(err, ErrDomainNotAllowed) {
+		t.Errorf("other domain: got %v; want ErrDomainNotAllowed", err)
+	}
+
+	// Unverified addresses don't count, whatever their domain.
+	idp.claims = func(c map[string]any) { c["email_verified"] = "false" }
+	_, err = login(t, idp, p, nil)
+	if !errors.Is(err, ErrDomainNotAllowed) {
+		t.Errorf("unverified email: got %v; want ErrDomainNotAllowed", err)
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	idp := newTestIDP(t)
+
+	// The same server under another name serves a document for a different issuer.
+	issuer := strings.Replace(idp.server.URL, "127.0.0.1", "localhost", 1)
+
+	_, err := New(context.Background(), Config{Issuer: issuer, ClientID: testClientID})
+	if err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("got %v; want an issuer mismatch error", err)
+	}
+}
@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter tracks attempts per key (for example a client IP and snippet ID)
+// and refuses a key once it has used up its allowance within the window.
+type Limiter struct {
+	mu       sync.Mutex
+	max      int
+	window   time.Duration
+	attempts map[string][]time.Time
+	swept    time.Time // when keys without recent attempts were last dropped
+}
+
+// New returns a Limiter that allows max attempts per key within window.
+func New(max int, window time.Duration) *Limiter {
+	return &Limiter{
+		max:      max,
+		window:   window,
+		attempts: make(map[string][]time.Time),
+		swept:    time.Now(),
+	}
+}
+
+// Allow records an attempt for the key and returns true if it is within the
+// allowance, or false if the key has already used it up. The check and the
+// record happen under one lock, so parallel requests can't all slip through
+// before any of them is counted. Call Reset after a successful attempt.
+func (l *Limiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	recent := l.prune(key, now)
+	if len(recent) >= l.max {
+		return false
+	}
+
+	l.attempts[key] = append(recent, now)
+	return true
+}
+
+// Reset forgets all attempts recorded for the key.
+func (l *Limiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.attempts, key)
+}
+
+// sweep drops every key whose attempts have all fallen outside the window,
+// at most once per window, so that keys which are never used again don't
+// stay in memory. It must be called with the mutex held.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < l.window {
+		return
+	}
+	l.swept = now
+
+	for key := range l.attempts {
+		l.prune(key, now)
+	}
+}
+
+// prune drops the attempts that fall outside the window. It must be called
+// with the mutex held.
+func (l *Limiter) prune(key string, now time.Time) []time.Time {
+	recent := l.attempts[key][:0]
+	for _, t := range l.attempts[key] {
+		if now.Sub(t) < l.window {
+			recent = append(recent, t)
+		}
+	}
+
+	if len(recent) == 0 {
+		delete(l.attempts, key)
+		return nil
+	}
+
+	l.attempts[key] = recent
+	return recent
+}
@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := New(3, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if !l.Allow("a") {
+			t.Fatalf("refused attempt %d, want 3 allowed", i+1)
+		}
+	}
+
+	if l.Allow("a") {
+		t.Fatal("allowed a 4th attempt")
+	}
+
+	// Other keys are tracked independently.
+	if !l.Allow("b") {
+		t.Fatal("unrelated key is refused")
+	}
+
+	l.Reset("a")
+	if !l.Allow("a") {
+		t.Fatal("still refused after reset")
+	}
+}
+
+func TestLimiterWindow(t *testing.T) {
+	l := New(1, 10*time.Millisecond)
+
+	l.Allow("a")
+	if l.Allow("a") {
+		t.Fatal("allowed a 2nd attempt")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if !l.Allow("a") {
+		t.Fatal("still refused after the window passed")
+	}
+}
+
+func TestLimiterParallel(t *testing.T) {
+	l := New(5, time.Minute)
+
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if l.Allow("a") {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := allowed.Load(); n != 5 {
+		t.Errorf("allowed %d parallel attempts; want 5", n)
+	}
+}
+
+func TestLimiterSweep(t *testing.T) {
+	l := New(3, 10*time.Millisecond)
+
+	for _, key := range []string{"a", "b", "c"} {
+		l.Allow(key)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	l.Allow("d")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.attempts) != 1 {
+		t.Errorf("got %d keys after the window passed; want only the new one", len(l.attempts))
+	}
+}
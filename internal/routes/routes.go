@@ -6,6 +6,7 @@ import (
 	"github.com/Hiwiii/snippetbox.git/config"
 	"github.com/Hiwiii/snippetbox.git/internal/handlers"
 	"github.com/Hiwiii/snippetbox.git/internal/middleware"
+	"github.com/Hiwiii/snippetbox.git/internal/models"
 	"github.com/julienschmidt/httprouter"
 	"github.com/justinas/alice"
 )
@@ -20,26 +21,84 @@ func Routes(app *config.Application, helpers *middleware.Helpers) http.Handler {
 		helpers.NotFound(w)
 	})
 
-	// File server for static files.
-	fileServer := http.FileServer(http.Dir("./ui/static/"))
-	router.Handler(http.MethodGet, "/static/*filepath", http.StripPrefix("/static", fileServer))
+	// Static files, including their fingerprinted URLs.
+	static := http.StripPrefix("/static", app.Assets)
+	router.Handler(http.MethodGet, "/static/*filepath", static)
+	router.Handler(http.MethodHead, "/static/*filepath", static)
 
 	// Create a dynamic middleware chain.
-	dynamic := alice.New(helpers.SessionManager.LoadAndSave)
+	dynamic := alice.New(helpers.SessionManager.LoadAndSave, middleware.Authenticate(app, helpers), middleware.Localize(helpers))
 
 	// Register dynamic routes (routes needing middleware for session handling).
 	router.Handler(http.MethodGet, "/", dynamic.ThenFunc(handlers.Home(app, helpers)))
+	router.Handler(http.MethodGet, "/snippets/mine", dynamic.ThenFunc(handlers.MySnippets(app, helpers)))
+	router.Handler(http.MethodGet, "/tags/:tag", dynamic.ThenFunc(handlers.TagView(app, helpers)))
 	router.Handler(http.MethodGet, "/snippet/view/:id", dynamic.ThenFunc(handlers.SnippetView(app, helpers)))
+	router.Handler(http.MethodGet, "/snippet/fork/:id", dynamic.ThenFunc(handlers.SnippetFork(app, helpers)))
+	router.Handler(http.MethodGet, "/snippet/download/:id", dynamic.ThenFunc(handlers.SnippetDownload(app, helpers)))
+	router.Handler(http.MethodPost, "/snippet/unlock/:id", dynamic.ThenFunc(handlers.SnippetUnlockPost(app, helpers)))
+	router.Handler(http.MethodPost, "/snippet/reveal/:id", dynamic.ThenFunc(handlers.SnippetRevealPost(app, helpers)))
+	router.Handler(http.MethodGet, "/snippet/manage/:id", dynamic.ThenFunc(handlers.SnippetManage(app, helpers)))
+	router.Handler(http.MethodPost, "/snippet/extend/:id", dynamic.ThenFunc(handlers.SnippetExtendPost(app, helpers)))
+	router.Handler(http.MethodPost, "/snippet/report/:id", dynamic.ThenFunc(handlers.SnippetReportPost(app, helpers)))
+	router.Handler(http.MethodPost, "/comment/moderate/:id", dynamic.ThenFunc(handlers.CommentModeratePost(app, helpers)))
 	router.Handler(http.MethodGet, "/snippet/create", dynamic.ThenFunc(handlers.SnippetCreate(app, helpers)))
 	router.Handler(http.MethodPost, "/snippet/create", dynamic.ThenFunc(handlers.SnippetCreatePost(app, helpers)))
+	router.Handler(http.MethodGet, "/login/oidc", dynamic.ThenFunc(handlers.UserLoginOIDC(app, helpers)))
+	router.Handler(http.MethodGet, "/login/oidc/callback", dynamic.ThenFunc(handlers.UserLoginOIDCCallback(app, helpers)))
+	router.Handler(http.MethodGet, "/login/2fa", dynamic.ThenFunc(handlers.UserLoginTwoFactor(app, helpers)))
+	router.Handler(http.MethodPost, "/login/2fa", dynamic.ThenFunc(handlers.UserLoginTwoFactorPost(app, helpers)))
+	router.Handler(http.MethodPost, "/logout", dynamic.ThenFunc(handlers.UserLogoutPost(app, helpers)))
+	router.Handler(http.MethodPost, "/locale", dynamic.ThenFunc(handlers.LocalePost(app, helpers)))
+	router.Handler(http.MethodPost, "/timezone", dynamic.ThenFunc(handlers.TimezonePost(app, helpers)))
+	router.Handler(http.MethodGet, "/user/:username", dynamic.ThenFunc(handlers.UserProfile(app, helpers)))
+	router.Handler(http.MethodGet, "/user/:username/avatar", dynamic.ThenFunc(handlers.UserAvatar(app, helpers)))
 
-	// Create a standard middleware chain for logging, recovery, and headers.
+	// Commenting and starring need an account, so that comments show who
+	// wrote them and stars can't be inflated, as does editing a profile.
+	authenticated := dynamic.Append(middleware.RequireRole(helpers, models.RoleUser))
+
+	router.Handler(http.MethodPost, "/snippet/comment/:id", authenticated.ThenFunc(handlers.CommentCreatePost(app, helpers)))
+	router.Handler(http.MethodPost, "/snippet/star/:id", authenticated.ThenFunc(handlers.SnippetStarPost(app, helpers)))
+	router.Handler(http.MethodPost, "/snippet/unstar/:id", authenticated.ThenFunc(handlers.SnippetUnstarPost(app, helpers)))
+	router.Handler(http.MethodGet, "/snippets/starred", authenticated.ThenFunc(handlers.StarredSnippets(app, helpers)))
+
+	// Forms which change account settings must also send the session's
+	// CSRF token.
+	account := authenticated.Append(middleware.VerifyCSRF(helpers))
+
+	router.Handler(http.MethodGet, "/account/profile", account.ThenFunc(handlers.AccountProfile(app, helpers)))
+	router.Handler(http.MethodPost, "/account/profile", account.ThenFunc(handlers.AccountProfilePost(app, helpers)))
+	router.Handler(http.MethodGet, "/account/2fa", account.ThenFunc(handlers.AccountTwoFactor(app, helpers)))
+	router.Handler(http.MethodPost, "/account/2fa", account.ThenFunc(handlers.AccountTwoFactorPost(app, helpers)))
+	router.Handler(http.MethodPost, "/account/2fa/disable", account.ThenFunc(handlers.AccountTwoFactorDisablePost(app, helpers)))
+
+	// The admin area is for moderators, except user management which is for
+	// admins. Its forms send the CSRF token too.
+	moderator := dynamic.Append(middleware.RequireRole(helpers, models.RoleModerator), middleware.VerifyCSRF(helpers))
+	admin := dynamic.Append(middleware.RequireRole(helpers, models.RoleAdmin), middleware.VerifyCSRF(helpers))
+
+	router.Handler(http.MethodGet, "/admin", moderator.ThenFunc(handlers.AdminDashboard(app, helpers)))
+	router.Handler(http.MethodGet, "/admin/snippets", moderator.ThenFunc(handlers.AdminSnippets(app, helpers)))
+	router.Handler(http.MethodPost, "/admin/snippets/delete/:id", moderator.ThenFunc(handlers.AdminSnippetDeletePost(app, helpers)))
+	router.Handler(http.MethodGet, "/admin/reports", moderator.ThenFunc(handlers.AdminReports(app, helpers)))
+	router.Handler(http.MethodPost, "/admin/reports/:id", moderator.ThenFunc(handlers.AdminReportPost(app, helpers)))
+	router.Handler(http.MethodGet, "/admin/log", moderator.ThenFunc(handlers.AdminModerationLog(app, helpers)))
+	router.Handler(http.MethodGet, "/admin/users", admin.ThenFunc(handlers.AdminUsers(app, helpers)))
+	router.Handler(http.MethodPost, "/admin/users/update/:id", admin.ThenFunc(handlers.AdminUserUpdatePost(app, helpers)))
+	router.Handler(http.MethodGet, "/admin/audit", admin.ThenFunc(handlers.AdminAudit(app, helpers)))
+	router.Handler(http.MethodGet, "/admin/audit/export", admin.ThenFunc(handlers.AdminAuditExport(app, helpers)))
+
+	// Create a standard middleware chain for logging, recovery, headers and
+	// compression.
 	standard := alice.New(
 		func(h http.Handler) http.Handler {
 			return middleware.RecoverPanic(app, helpers, h)
 		},
+		middleware.RequestID,
 		middleware.LogRequest(app),
 		middleware.SecureHeaders,
+		middleware.Compress,
 	)
 
 	// Wrap the router with standard middleware and return.
@@ -0,0 +1,83 @@
+package templates
+
+import (
+	"strings"
+
+	"github.com/Hiwiii/snippetbox.git/internal/models"
+)
+
+// CommentThread is a comment prepared for display, along with its replies.
+type CommentThread struct {
+	*models.Comment
+	Replies     []*CommentThread
+	CanModerate bool
+	CanReply    bool
+}
+
+// AnnotatedLine is a line of a snippet file, with the comments whose line
+// range ends on it.
+type AnnotatedLine struct {
+	Number      int
+	Text        string
+	Highlighted bool
+	Comments    []*CommentThread
+}
+
+// AnnotatedFile is a snippet file split into annotated lines.
+type AnnotatedFile struct {
+	*models.SnippetFile
+	Lines []*AnnotatedLine
+}
+
+// Annotate prepares the files and comments of a snippet for the view page.
+// Anchored comments are attached to the last line of their range in the
+// annotated files, and the lines they cover are highlighted; ranges running
+// past the end of a file are clamped to its last line. The remaining
+// comments are returned separately as general comments. If canModerate is
+// true every comment is shown with moderation controls, and if canReply is
+// true with a reply form.
+func Annotate(files []*models.SnippetFile, comments []*models.Comment, canModerate, canReply bool) ([]*AnnotatedFile, []*CommentThread) {
+	annotated := make([]*AnnotatedFile, len(files))
+	byID := make(map[int]*AnnotatedFile, len(files))
+
+	for i, f := range files {
+		af := &AnnotatedFile{SnippetFile: f}
+		for n, text := range strings.Split(strings.ReplaceAll(f.Content, "\r\n", "\n"), "\n") {
+			af.Lines = append(af.Lines, &AnnotatedLine{Number: n + 1, Text: text})
+		}
+		annotated[i] = af
+		byID[f.ID] = af
+	}
+
+	general := []*CommentThread{}
+
+	for _, c := range comments {
+		thread := newCommentThread(c, canModerate, canReply)
+
+		af, ok := byID[c.FileID]
+		if !c.Anchored() || !ok {
+			general = append(general, thread)
+			continue
+		}
+
+		start := min(max(c.LineStart, 1), len(af.Lines))
+		end := min(max(c.LineEnd, start), len(af.Lines))
+
+		for _, line := range af.Lines[start-1 : end] {
+			line.Highlighted = true
+		}
+		last := af.Lines[end-1]
+		last.Comments = append(last.Comments, thread)
+	}
+
+	return annotated, general
+}
+
+// newCommentThread wraps a comment and its replies for display.
+func newCommentThread(c *models.Comment, canModerate, canReply bool) *CommentThread {
+	thread := &CommentThread{Comment: c, CanModerate: canModerate, CanReply: canReply}
+	for _, reply := range c.Replies {
+		thread.Replies = append(thread.Replies, newCommentThread(reply, canModerate, canReply))
+	}
+	return thread
+}
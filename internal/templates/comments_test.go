@@ -0,0 +1,51 @@
+package templates
+
+import (
+	"testing"
+
+	"github.com/Hiwiii/snippetbox.git/internal/models"
+)
+
+func TestAnnotate(t *testing.T) {
+	files := []*models.SnippetFile{
+		{ID: 1, Name: "main.go", Content: "package main\r\n\r\nfunc main() {\r\n}"},
+		{ID: 2, Name: "README", Content: "hello"},
+	}
+
+	comments := []*models.Comment{
+		{ID: 1, Body: "general"},
+		{ID: 2, Body: "range", FileID: 1, LineStart: 2, LineEnd: 3, Replies: []*models.Comment{{ID: 4, Body: "reply"}}},
+		{ID: 3, Body: "past the end", FileID: 2, LineStart: 5, LineEnd: 9},
+		{ID: 5, Body: "unknown file", FileID: 7, LineStart: 1, LineEnd: 1},
+	}
+
+	annotated, general := Annotate(files, comments, true, true)
+
+	if len(annotated) != 2 {
+		t.Fatalf("got %d files; want 2", len(annotated))
+	}
+
+	lines := annotated[0].Lines
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines; want 4", len(lines))
+	}
+	for i, want := range []bool{false, true, true, false} {
+		if lines[i].Highlighted != want {
+			t.Errorf("line %d highlighted = %v; want %v", i+1, lines[i].Highlighted, want)
+		}
+	}
+	if len(lines[2].Comments) != 1 || lines[2].Comments[0].ID != 2 {
+		t.Fatalf("line 3 comments = %v; want comment 2", lines[2].Comments)
+	}
+	if replies := lines[2].Comments[0].Replies; len(replies) != 1 || !replies[0].CanModerate || !replies[0].CanReply {
+		t.Errorf("replies = %v; want one reply with moderation controls and a reply form", replies)
+	}
+
+	if c := annotated[1].Lines[0].Comments; len(c) != 1 || c[0].ID != 3 {
+		t.Errorf("README comments = %v; want comment 3 clamped to the last line", c)
+	}
+
+	if len(general) != 2 || general[0].ID != 1 || general[1].ID != 5 {
+		t.Errorf("general comments = %v; want comments 1 and 5", general)
+	}
+}
@@ -0,0 +1,62 @@
+package templates
+
+import (
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+var (
+	// paragraphRX splits text into paragraphs on blank lines.
+	paragraphRX = regexp.MustCompile(`\n\s*\n`)
+	// codeRX matches `inline code`.
+	codeRX = regexp.MustCompile("`([^`\n]+)`")
+	// linkRX matches [text](url) for http and https URLs only, so that
+	// javascript: and data: URLs are never turned into links.
+	linkRX = regexp.MustCompile(`\[([^\]\n]+)\]\((https?://[^\s)*]+)\)`)
+	// boldRX matches **bold** text.
+	boldRX = regexp.MustCompile(`\*\*([^*\n]+)\*\*`)
+	// italicRX matches *italic* text.
+	italicRX = regexp.MustCompile(`\*([^*\n]+)\*`)
+)
+
+// markdown renders a small subset of Markdown used in comments: paragraphs,
+// line breaks, `code`, **bold**, *italic* and [links](https://...). The text
+// is HTML escaped before any formatting is applied, so it can't inject markup.
+func markdown(s string) template.HTML {
+	s = strings.ReplaceAll(strings.TrimSpace(s), "\r\n", "\n")
+	if s == "" {
+		return ""
+	}
+
+	var b strings.Builder
+
+	for _, paragraph := range paragraphRX.Split(s, -1) {
+		b.WriteString("<p>")
+
+		// Leave the contents of code spans unformatted.
+		rest := paragraph
+		for _, loc := range codeRX.FindAllStringSubmatchIndex(paragraph, -1) {
+			b.WriteString(markdownInline(paragraph[len(paragraph)-len(rest) : loc[0]]))
+			b.WriteString("<code>")
+			b.WriteString(template.HTMLEscapeString(paragraph[loc[2]:loc[3]]))
+			b.WriteString("</code>")
+			rest = paragraph[loc[1]:]
+		}
+		b.WriteString(markdownInline(rest))
+
+		b.WriteString("</p>")
+	}
+
+	return template.HTML(b.String())
+}
+
+// markdownInline escapes a piece of text and applies the link and emphasis
+// formatting to it.
+func markdownInline(s string) string {
+	s = template.HTMLEscapeString(s)
+	s = linkRX.ReplaceAllString(s, `<a href="$2" rel="nofollow noopener">$1</a>`)
+	s = boldRX.ReplaceAllString(s, `<strong>$1</strong>`)
+	s = italicRX.ReplaceAllString(s, `<em>$1</em>`)
+	return strings.ReplaceAll(s, "\n", "<br>")
+}
@@ -0,0 +1,63 @@
+package templates
+
+import (
+	"html/template"
+	"testing"
+)
+
+func TestMarkdown(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  template.HTML
+	}{
+		{
+			name:  "Empty",
+			input: "  \n ",
+			want:  "",
+		},
+		{
+			name:  "Paragraphs and line breaks",
+			input: "one\ntwo\r\n\r\nthree",
+			want:  "<p>one<br>two</p><p>three</p>",
+		},
+		{
+			name:  "Emphasis",
+			input: "**bold** and *italic*",
+			want:  "<p><strong>bold</strong> and <em>italic</em></p>",
+		},
+		{
+			name:  "Code is not formatted",
+			input: "see `a **b** <c>` here",
+			want:  "<p>see <code>a **b** &lt;c&gt;</code> here</p>",
+		},
+		{
+			name:  "Link",
+			input: "[docs](https://go.dev/doc?a=1&b=2)",
+			want:  `<p><a href="https://go.dev/doc?a=1&amp;b=2" rel="nofollow noopener">docs</a></p>`,
+		},
+		{
+			name:  "HTML is escaped",
+			input: `<script>alert("x")</script>`,
+			want:  "<p>&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;</p>",
+		},
+		{
+			name:  "JavaScript links are not linked",
+			input: "[click](javascript:alert(1))",
+			want:  "<p>[click](javascript:alert(1))</p>",
+		},
+		{
+			name:  "Quotes can't break out of the href",
+			input: `[x](https://a.example/"onmouseover="alert(1))`,
+			want:  `<p><a href="https://a.example/&#34;onmouseover=&#34;alert(1" rel="nofollow noopener">x</a>)</p>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := markdown(tt.input); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
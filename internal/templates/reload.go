@@ -0,0 +1,181 @@
+package templates
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Hiwiii/snippetbox.git/internal/i18n"
+)
+
+// Reloader re-parses the templates whenever a file under html/ changes. It is
+// meant for development: every call to Cache stats the template files, which
+// production servers avoid by using a cache built once with NewLocaleCache.
+// Message catalogs are not reloaded; restart the server after changing them.
+type Reloader struct {
+	fsys      fs.FS
+	assetPath func(string) string
+	bundle    *i18n.Bundle
+
+	mu    sync.Mutex
+	stamp string
+	cache LocaleCache
+	err   error
+}
+
+// NewReloader returns a Reloader for the templates in the html directory of
+// fsys, which should be a directory on disk such as os.DirFS("./ui").
+// assetPath and bundle are passed on to NewLocaleCache.
+func NewReloader(fsys fs.FS, assetPath func(string) string, bundle *i18n.Bundle) *Reloader {
+	return &Reloader{fsys: fsys, assetPath: assetPath, bundle: bundle}
+}
+
+// Cache returns the current templates, parsing them again if any file has
+// been added, removed or modified since the last call. A parse error is
+// returned until the file is fixed.
+func (r *Reloader) Cache() (LocaleCache, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stamp, err := r.fingerprint()
+	if err != nil {
+		return nil, err
+	}
+
+	if stamp != r.stamp {
+		r.cache, r.err = NewLocaleCache(r.fsys, r.assetPath, r.bundle)
+		r.stamp = stamp
+	}
+
+	return r.cache, r.err
+}
+
+// fingerprint summarises the name, size and modification time of every file
+// under html/, so that any change gives a different result.
+func (r *Reloader) fingerprint() (string, error) {
+	var b strings.Builder
+
+	err := fs.WalkDir(r.fsys, "html", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "%s %d %d\n", name, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+
+	return b.String(), err
+}
+
+// templateErrorRX matches the location at the start of errors from
+// html/template, such as "template: home.tmpl:12: unexpected EOF".
+var templateErrorRX = regexp.MustCompile(`template: ([^:\s]+):(\d+)`)
+
+// SourceLine is a line of a template shown on the error page.
+type SourceLine struct {
+	Number int
+	Text   string
+	Error  bool // the line the error is on
+}
+
+// templateError is the data for the development error page.
+type templateError struct {
+	Message string
+	File    string
+	Lines   []SourceLine
+}
+
+// errorPage is standalone so that it works when the page templates don't.
+var errorPage = template.Must(template.New("error").Parse(`<!doctype html>
+<html lang="en">
+  <head>
+    <meta charset="utf-8">
+    <title>Template error - Snippetbox</title>
+    <link rel="stylesheet" href="/static/css/main.css">
+  </head>
+  <body>
+    <header>
+      <h1>Template error</h1>
+    </header>
+    <main>
+      <div class="flash error">{{.Message}}</div>
+      {{with .File}}<h2>{{.}}</h2>{{end}}
+      {{with .Lines}}
+      <table class="code">
+        {{range .}}
+        <tr {{if .Error}}class="highlighted"{{end}}>
+          <td class="line-number">{{.Number}}</td>
+          <td><pre>{{.Text}}</pre></td>
+        </tr>
+        {{end}}
+      </table>
+      {{end}}
+      <p>The page reloads the templates on every request, so fix the file and refresh.</p>
+    </main>
+  </body>
+</html>
+`))
+
+// WriteError writes a page describing a template parse or execution error,
+// with the lines of the template around the error. It is only for
+// development, since it shows the source of the templates.
+func (r *Reloader) WriteError(w http.ResponseWriter, err error) {
+	data := templateError{Message: err.Error()}
+
+	if m := templateErrorRX.FindStringSubmatch(err.Error()); m != nil {
+		line, _ := strconv.Atoi(m[2])
+		data.File, data.Lines = sourceAround(r.fsys, m[1], line)
+	}
+
+	buf := new(bytes.Buffer)
+	if execErr := errorPage.Execute(buf, data); execErr != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusInternalServerError)
+	buf.WriteTo(w)
+}
+
+// sourceAround finds the template file with the given base name under html/
+// and returns its path and up to five lines either side of line.
+func sourceAround(fsys fs.FS, name string, line int) (string, []SourceLine) {
+	var file string
+
+	fs.WalkDir(fsys, "html", func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && path.Base(p) == name {
+			file = p
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if file == "" {
+		return "", nil
+	}
+
+	src, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return file, nil
+	}
+
+	var lines []SourceLine
+	for i, text := range strings.Split(string(src), "\n") {
+		n := i + 1
+		if n >= line-5 && n <= line+5 {
+			lines = append(lines, SourceLine{Number: n, Text: text, Error: n == line})
+		}
+	}
+
+	return file, lines
+}
@@ -0,0 +1,96 @@
+package templates
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestReloader(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"html/base.tmpl":         {Data: []byte(`{{define "base"}}{{template "title" .}}{{end}}`), ModTime: start},
+		"html/partials/nav.tmpl": {Data: []byte(`{{define "nav"}}{{end}}`), ModTime: start},
+		"html/pages/home.tmpl":   {Data: []byte(`{{define "title"}}Home{{end}}`), ModTime: start},
+	}
+
+	r := NewReloader(fsys, nil, testBundle(t))
+
+	render := func() (string, error) {
+		cache, err := r.Cache()
+		if err != nil {
+			return "", err
+		}
+		var b strings.Builder
+		err = cache["en"]["home.tmpl"].ExecuteTemplate(&b, "base", nil)
+		return b.String(), err
+	}
+
+	if got, err := render(); err != nil || got != "Home" {
+		t.Fatalf("got %q, %v; want Home", got, err)
+	}
+
+	// An unchanged tree reuses the parsed templates.
+	first, _ := r.Cache()
+	second, _ := r.Cache()
+	if first["en"]["home.tmpl"] != second["en"]["home.tmpl"] {
+		t.Error("templates were parsed again without a change")
+	}
+
+	// Editing a file is picked up.
+	fsys["html/pages/home.tmpl"] = &fstest.MapFile{Data: []byte(`{{define "title"}}Welcome{{end}}`), ModTime: start.Add(time.Second)}
+	if got, err := render(); err != nil || got != "Welcome" {
+		t.Fatalf("got %q, %v; want Welcome", got, err)
+	}
+
+	// A syntax error is reported until it is fixed.
+	fsys["html/pages/home.tmpl"] = &fstest.MapFile{Data: []byte("{{define \"title\"}}\n{{.Broken}\n{{end}}"), ModTime: start.Add(2 * time.Second)}
+	for i := 0; i < 2; i++ {
+		if _, err := r.Cache(); err == nil || !strings.Contains(err.Error(), "home.tmpl:2") {
+			t.Fatalf("got error %v; want a parse error on home.tmpl:2", err)
+		}
+	}
+
+	// New pages are picked up too.
+	fsys["html/pages/home.tmpl"] = &fstest.MapFile{Data: []byte(`{{define "title"}}Fixed{{end}}`), ModTime: start.Add(3 * time.Second)}
+	fsys["html/pages/about.tmpl"] = &fstest.MapFile{Data: []byte(`{{define "title"}}About{{end}}`), ModTime: start.Add(3 * time.Second)}
+	if got, err := render(); err != nil || got != "Fixed" {
+		t.Fatalf("got %q, %v; want Fixed", got, err)
+	}
+	if cache, _ := r.Cache(); cache["en"]["about.tmpl"] == nil {
+		t.Error("new page was not parsed")
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	fsys := fstest.MapFS{
+		"html/base.tmpl":         {Data: []byte(`{{define "base"}}{{end}}`)},
+		"html/partials/nav.tmpl": {Data: []byte(`{{define "nav"}}{{end}}`)},
+		"html/pages/home.tmpl":   {Data: []byte("{{define \"title\"}}\n<b>{{.Broken}\n{{end}}")},
+	}
+
+	_, err := NewTemplateCache(fsys, nil, nil)
+	if err == nil {
+		t.Fatal("got no parse error")
+	}
+
+	rr := httptest.NewRecorder()
+	NewReloader(fsys, nil, testBundle(t)).WriteError(rr, err)
+
+	if rr.Code != 500 {
+		t.Errorf("got status %d; want 500", rr.Code)
+	}
+
+	body := rr.Body.String()
+	for _, want := range []string{
+		"html/pages/home.tmpl",
+		`<tr class="highlighted">`,
+		"&lt;b&gt;{{.Broken}",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body doesn't contain %q:\n%s", want, body)
+		}
+	}
+}
@@ -1,39 +1,188 @@
 package templates
 
 import (
+	"fmt"
 	"html/template"
-	"path/filepath"
+	"io/fs"
+	"path"
+	"strings"
 	"time"
 
+	"github.com/Hiwiii/snippetbox.git/internal/expiry"
+	"github.com/Hiwiii/snippetbox.git/internal/i18n"
 	"github.com/Hiwiii/snippetbox.git/internal/models"
 )
 
-// humanDate formats a time.Time object into a human-readable format.
-func humanDate(t time.Time) string {
-	return t.Format("02 Jan 2006 at 15:04")
+// languages returns the languages a snippet file can be marked as.
+func languages() []string {
+	return models.Languages
+}
+
+// roles returns the roles a user can be given.
+func roles() []models.Role {
+	return models.Roles
+}
+
+// reportReasons returns the categories a snippet can be reported under.
+func reportReasons() []models.ReportReason {
+	return models.ReportReasons
+}
+
+// visibilities returns the visibilities a snippet can be created with.
+func visibilities() []models.Visibility {
+	return models.Visibilities
+}
+
+// auditActions returns the actions the audit log can be filtered by.
+func auditActions() []string {
+	return models.AuditActions
+}
+
+// humanBytes formats a size in bytes using binary prefixes, e.g. "1.5 KiB".
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// datetime formats t for the datetime attribute of a <time> element.
+func datetime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
 }
 
 // functions is a global template.FuncMap object where we register custom functions.
 var functions = template.FuncMap{
-	"humanDate": humanDate,
+	"languages":     languages,
+	"markdown":      markdown,
+	"roles":         roles,
+	"humanBytes":    humanBytes,
+	"datetime":      datetime,
+	"reportReasons": reportReasons,
+	"visibilities":  visibilities,
+	"auditActions":  auditActions,
+	"zoned":         zoned,
 }
 
 // TemplateData holds the dynamic data passed to HTML templates.
 type TemplateData struct {
-	CurrentYear int
-	Snippet     *models.Snippet
-	Snippets    []*models.Snippet
-	Form        any
-	Flash       string
+	CurrentYear       int
+	Snippet           *models.Snippet
+	Snippets          []*models.Snippet
+	Tags              []*models.Tag
+	MostStarred       []*models.Snippet // most starred in the last week
+	Starred           bool              // true if the current user starred the snippet
+	Author            *models.User      // author of the snippet, if it was created logged in
+	Profile           *models.User      // user whose profile is shown
+	PrevPage          int               // previous page of a list, or 0 if there is none
+	NextPage          int               // next page of a list, or 0 if there is none
+	TOTPSecret        string            // secret being set up in an authenticator app
+	TOTPURI           template.URL      // otpauth:// URI of TOTPSecret
+	RecoveryCodes     []string          // new recovery codes, shown only once
+	RecoveryCodesLeft int               // unused recovery codes of the current user
+	Tag               string
+	Form              any
+	Flash             string
+	ExpiryPolicy      *expiry.Policy
+	OwnsSnippet       bool
+	ParentAvailable   bool
+	Forks             []*models.Snippet
+	Files             []*AnnotatedFile
+	Comments          []*CommentThread
+	CommentForm       any
+	IsAuthenticated   bool
+	LoginEnabled      bool
+	CurrentUser       *models.User
+	CSRFToken         string // sent by forms posting to the admin and account pages
+	Users             []*models.User
+	Stats             *models.Stats
+	Query             string
+	ReportQueue       []*models.ReportedSnippet
+	OpenReports       int
+	ModerationActions []*models.ModerationAction
+	AuditEvents       []*models.AuditEvent
+	Locale            string          // language tag of the page
+	LocaleChosen      bool            // true if the locale was picked rather than negotiated
+	Locales           []*i18n.Catalog // the locales offered in the language picker
+	CurrentPath       string          // where to return after changing the locale
+	Timezone          string          // name of the time zone dates are shown in
+	Zone              *time.Location  // time zone dates are shown in, for humanDate
+	TimezoneChosen    bool            // true if the zone was picked rather than detected
+}
+
+// localeFunctions returns the template functions which depend on the locale:
+// T translates a message, humanDate formats a time.Time and relativeTime
+// describes it relative to now. The time zone is only known once a request
+// comes in, so humanDate takes it from the template data, as in
+// {{humanDate $.Zone .Created}}; a nil zone is UTC.
+func localeFunctions(loc *i18n.Localizer) template.FuncMap {
+	return template.FuncMap{
+		"T": loc.T,
+		"humanDate": func(zone *time.Location, t time.Time) string {
+			return loc.In(zone).Date(t)
+		},
+		"relativeTime": func(t time.Time) string {
+			return loc.Relative(t, time.Now())
+		},
+	}
 }
 
-// NewTemplateCache initializes and returns a map of cached templates.
-func NewTemplateCache() (map[string]*template.Template, error) {
+// Zoned is the data of a partial template which shows dates, together with
+// the time zone to show them in. Pages pass it with the zoned function, as in
+// {{template "snippets" (zoned $.Zone .Snippets)}}.
+type Zoned struct {
+	Zone *time.Location
+	Data any
+}
+
+// zoned pairs data with a time zone for a partial template.
+func zoned(zone *time.Location, data any) Zoned {
+	return Zoned{Zone: zone, Data: data}
+}
+
+// plainAssetPath is the asset function used when no fingerprinting is set up.
+func plainAssetPath(name string) string {
+	return "/static/" + strings.TrimPrefix(name, "/")
+}
+
+// LocaleCache holds a template cache for each locale, keyed by language tag.
+type LocaleCache map[string]map[string]*template.Template
+
+// NewLocaleCache parses the templates once for every locale in bundle.
+func NewLocaleCache(fsys fs.FS, assetPath func(string) string, bundle *i18n.Bundle) (LocaleCache, error) {
+	caches := LocaleCache{}
+
+	for _, c := range bundle.Catalogs() {
+		cache, err := NewTemplateCache(fsys, assetPath, bundle.Localizer(c.Tag))
+		if err != nil {
+			return nil, err
+		}
+		caches[c.Tag] = cache
+	}
+
+	return caches, nil
+}
+
+// NewTemplateCache initializes and returns a map of cached templates, parsed
+// from the html directory of fsys. assetPath implements the asset template
+// function, which returns the URL of a static file such as "css/main.css"; if
+// it is nil the plain /static/ URL is used. The T, humanDate and relativeTime
+// functions translate into the language of loc.
+func NewTemplateCache(fsys fs.FS, assetPath func(string) string, loc *i18n.Localizer) (map[string]*template.Template, error) {
+	if assetPath == nil {
+		assetPath = plainAssetPath
+	}
 	// Initialize a new map to act as the cache.
 	cache := map[string]*template.Template{}
 
-	// Get a list of all page templates in the `./ui/html/pages` folder.
-	pages, err := filepath.Glob("./ui/html/pages/*.tmpl")
+	// Get a list of all page templates in the `html/pages` folder.
+	pages, err := fs.Glob(fsys, "html/pages/*.tmpl")
 	if err != nil {
 		return nil, err
 	}
@@ -41,17 +190,17 @@ func NewTemplateCache() (map[string]*template.Template, error) {
 	// Loop through each file path.
 	for _, page := range pages {
 		// Extract the file name (e.g., "home.tmpl").
-		name := filepath.Base(page)
+		name := path.Base(page)
 
-		// Create a slice with the base, navigation partial, and current page template.
-		files := []string{
-			"./ui/html/base.tmpl",
-			"./ui/html/partials/nav.tmpl",
+		// The base template, all the partials and the current page.
+		patterns := []string{
+			"html/base.tmpl",
+			"html/partials/*.tmpl",
 			page,
 		}
 
-		// Parse the template files and attach the custom functions using the Funcs method.
-		ts, err := template.New(name).Funcs(functions).ParseFiles(files...)
+		// Parse the files and attach the custom functions using the Funcs method.
+		ts, err := template.New(name).Funcs(functions).Funcs(localeFunctions(loc)).Funcs(template.FuncMap{"asset": assetPath}).ParseFS(fsys, patterns...)
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,344 @@
+package templates
+
+import (
+	"io/fs"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/Hiwiii/snippetbox.git/internal/expiry"
+	"github.com/Hiwiii/snippetbox.git/internal/forms"
+	"github.com/Hiwiii/snippetbox.git/internal/i18n"
+	"github.com/Hiwiii/snippetbox.git/internal/models"
+	"github.com/Hiwiii/snippetbox.git/ui"
+)
+
+// testBundle returns a bundle with English and German catalogs.
+func testBundle(t *testing.T) *i18n.Bundle {
+	t.Helper()
+	bundle, err := i18n.Load(fstest.MapFS{
+		"en.json": {Data: []byte(`{"name": "English", "messages": {"hello": "Hello, %s"}}`)},
+		"de.json": {Data: []byte(`{"name": "Deutsch", "date_layout": "02.01.2006", "messages": {"hello": "Hallo, %s"}}`)},
+	}, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bundle
+}
+
+func TestHumanBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{5 << 20, "5.0 MiB"},
+		{3 << 30, "3.0 GiB"},
+	}
+
+	for _, tt := range tests {
+		if got := humanBytes(tt.n); got != tt.want {
+			t.Errorf("humanBytes(%d) = %q; want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestNewTemplateCache(t *testing.T) {
+	fsys := fstest.MapFS{
+		"html/base.tmpl":          {Data: []byte(`{{define "base"}}<title>{{template "title" .}}</title>{{template "nav" .}}{{end}}`)},
+		"html/partials/nav.tmpl":  {Data: []byte(`{{define "nav"}}<nav>{{humanBytes 2048}}</nav>{{end}}`)},
+		"html/pages/home.tmpl":    {Data: []byte(`{{define "title"}}Home{{end}}`)},
+		"html/pages/about.tmpl":   {Data: []byte(`{{define "title"}}About{{end}}`)},
+		"html/pages/ignored.html": {Data: []byte(`{{define "title"}}Ignored{{end}}`)},
+	}
+
+	cache, err := NewTemplateCache(fsys, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cache) != 2 {
+		t.Fatalf("got %d templates; want 2", len(cache))
+	}
+
+	// Each page gets its own set, so their "title" blocks don't clash.
+	for name, want := range map[string]string{
+		"home.tmpl":  "<title>Home</title><nav>2.0 KiB</nav>",
+		"about.tmpl": "<title>About</title><nav>2.0 KiB</nav>",
+	} {
+		var buf strings.Builder
+		err := cache[name].ExecuteTemplate(&buf, "base", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != want {
+			t.Errorf("%s: got %q; want %q", name, buf.String(), want)
+		}
+	}
+
+	// A missing base template is an error rather than a broken page.
+	delete(fsys, "html/base.tmpl")
+	if _, err := NewTemplateCache(fsys, nil, nil); err == nil {
+		t.Error("got no error without a base template")
+	}
+}
+
+func TestNewLocaleCache(t *testing.T) {
+	fsys := fstest.MapFS{
+		"html/base.tmpl":         {Data: []byte(`{{define "base"}}{{T "hello" "Gopher"}} {{humanDate nil .}}{{end}}`)},
+		"html/partials/nav.tmpl": {Data: []byte(`{{define "nav"}}{{end}}`)},
+		"html/pages/home.tmpl":   {Data: []byte(`{{define "title"}}{{end}}`)},
+	}
+
+	caches, err := NewLocaleCache(fsys, nil, testBundle(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	for tag, want := range map[string]string{
+		"en": "Hello, Gopher 01 Mar 2024 at 12:30 UTC",
+		"de": "Hallo, Gopher 01.03.2024",
+	} {
+		var buf strings.Builder
+		err := caches[tag]["home.tmpl"].ExecuteTemplate(&buf, "base", date)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != want {
+			t.Errorf("%s: got %q; want %q", tag, buf.String(), want)
+		}
+	}
+}
+
+func TestHumanDateZone(t *testing.T) {
+	fsys := fstest.MapFS{
+		"html/base.tmpl":          {Data: []byte(`{{define "base"}}{{template "date" (zoned .Zone .Created)}}{{end}}`)},
+		"html/partials/date.tmpl": {Data: []byte(`{{define "date"}}<time datetime="{{datetime .Data}}">{{humanDate .Zone .Data}}</time>{{end}}`)},
+		"html/partials/nav.tmpl":  {Data: []byte(`{{define "nav"}}{{end}}`)},
+		"html/pages/home.tmpl":    {Data: []byte(`{{define "title"}}{{end}}`)},
+	}
+
+	bundle := testBundle(t)
+	caches, err := NewLocaleCache(fsys, nil, bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokyo, err := i18n.LoadZone("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same cached template shows each request's dates in its own zone.
+	date := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		zone *time.Location
+		want string
+	}{
+		{tokyo, `<time datetime="2024-03-01T12:30:00Z">01 Mar 2024 at 21:30 JST</time>`},
+		{nil, `<time datetime="2024-03-01T12:30:00Z">01 Mar 2024 at 12:30 UTC</time>`},
+		{time.UTC, `<time datetime="2024-03-01T12:30:00Z">01 Mar 2024 at 12:30 UTC</time>`},
+	} {
+		var buf strings.Builder
+		data := struct {
+			Zone    *time.Location
+			Created time.Time
+		}{tt.zone, date}
+		err = caches["en"]["home.tmpl"].ExecuteTemplate(&buf, "base", data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("%v: got %q; want %q", tt.zone, buf.String(), tt.want)
+		}
+	}
+}
+
+// messageKeyRX matches the keys passed to T in templates. Keys built with
+// printf, such as role names, aren't checked.
+var messageKeyRX = regexp.MustCompile(`\bT "([^"]+)"`)
+
+func TestEmbeddedTemplates(t *testing.T) {
+	locales, err := fs.Sub(ui.Files, "locales")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := i18n.Load(locales, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caches, err := NewLocaleCache(ui.Files, nil, bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range bundle.Catalogs() {
+		if caches[c.Tag]["home.tmpl"] == nil {
+			t.Errorf("home.tmpl is missing from the embedded templates for %s", c.Tag)
+		}
+	}
+
+	// Every message used by a template must be in the default catalog, which
+	// the others fall back to.
+	en := bundle.Catalogs()[0]
+	err = fs.WalkDir(ui.Files, "html", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		src, err := fs.ReadFile(ui.Files, name)
+		if err != nil {
+			return err
+		}
+		for _, m := range messageKeyRX.FindAllStringSubmatch(string(src), -1) {
+			if _, ok := en.Messages[m[1]]; !ok {
+				t.Errorf("%s: message %q is missing from the %s catalog", name, m[1], en.Tag)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fieldErrorsRX matches templates which read the errors of a form directly
+// rather than through FieldError.
+var fieldErrorsRX = regexp.MustCompile(`\.FieldErrors\b`)
+
+func TestFormErrors(t *testing.T) {
+	locales, err := fs.Sub(ui.Files, "locales")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := i18n.Load(locales, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	caches, err := NewLocaleCache(ui.Files, nil, bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	presets, err := expiry.ParsePresets("24h,168h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := &expiry.Policy{Presets: presets, Now: time.Now}
+	snippet := &models.Snippet{ID: 3, Title: "x", Expires: time.Now().Add(time.Hour)}
+
+	createForm := forms.SnippetCreateForm{Files: []forms.SnippetFileForm{{}, {}}}
+	createForm.CheckField(false, "title", "Title error")
+	createForm.CheckField(false, "files[1].content", "Content error")
+	createForm.CheckField(false, "secrets", "Secrets error")
+
+	unlockForm := forms.SnippetUnlockForm{}
+	unlockForm.CheckField(false, "password", "Password error")
+
+	commentForm := forms.CommentForm{}
+	commentForm.CheckField(false, "body", "Body error")
+	commentForm.Check(false, "Comment error")
+
+	profileForm := forms.ProfileForm{}
+	profileForm.CheckField(false, "avatar", "Avatar error")
+
+	twoFactorForm := forms.TwoFactorForm{}
+	twoFactorForm.CheckField(false, "code", "Code error")
+
+	auditForm := forms.AuditFilterForm{}
+	auditForm.CheckField(false, "to", "Date error")
+
+	tests := []struct {
+		page string
+		data *TemplateData
+		want []string
+	}{
+		{
+			page: "create.tmpl",
+			data: &TemplateData{Form: createForm, ExpiryPolicy: policy},
+			want: []string{
+				`<label class="error">Title error</label>`,
+				`<label class="error">Content error</label>`,
+				`<label class="error">Secrets error</label>`,
+			},
+		},
+		{
+			page: "unlock.tmpl",
+			data: &TemplateData{Snippet: snippet, Form: forms.SnippetUnlockForm{}},
+			want: nil,
+		},
+		{
+			page: "unlock.tmpl",
+			data: &TemplateData{Snippet: snippet, Form: unlockForm},
+			want: []string{`<label class="error">Password error</label>`},
+		},
+		{
+			page: "view.tmpl",
+			data: &TemplateData{IsAuthenticated: true, Snippet: snippet, CommentForm: commentForm, ExpiryPolicy: policy, Form: forms.SnippetExtendForm{}},
+			want: []string{
+				`<label class="error">Body error</label>`,
+				`<p class="error">Comment error</p>`,
+			},
+		},
+		{
+			page: "account_profile.tmpl",
+			data: &TemplateData{Profile: &models.User{Username: "jane", HasAvatar: true}, Form: profileForm},
+			want: []string{`<label class="error">Avatar error</label>`},
+		},
+		{
+			page: "login_2fa.tmpl",
+			data: &TemplateData{Form: twoFactorForm},
+			want: []string{`<label class="error">Code error</label>`},
+		},
+		{
+			page: "account_2fa.tmpl",
+			data: &TemplateData{TOTPSecret: "JBSWY3DPEHPK3PXP", TOTPURI: "otpauth://totp/x", Form: twoFactorForm},
+			want: []string{`<label class="error">Code error</label>`, `href='otpauth://totp/x'`},
+		},
+		{
+			page: "admin_audit.tmpl",
+			data: &TemplateData{CurrentUser: &models.User{ID: 1, Role: models.RoleAdmin}, Form: auditForm},
+			want: []string{`<label class="error">Date error</label>`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.page, func(t *testing.T) {
+			var buf strings.Builder
+			if err := caches["en"][tt.page].ExecuteTemplate(&buf, "base", tt.data); err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("%q is missing from the page", want)
+				}
+			}
+			if tt.want == nil && strings.Contains(buf.String(), `class="error"`) {
+				t.Error("got an error on a form without errors")
+			}
+		})
+	}
+
+	// Templates read errors through FieldError only, so that a typo in the
+	// form is an execution error rather than an error that never shows.
+	err = fs.WalkDir(ui.Files, "html", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		src, err := fs.ReadFile(ui.Files, name)
+		if err != nil {
+			return err
+		}
+		if fieldErrorsRX.Match(src) {
+			t.Errorf("%s reads FieldErrors; use FieldError instead", name)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,64 @@
+package totp
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"strings"
+)
+
+// recoveryAlphabet leaves out characters which are easily confused when
+// written down, such as 0/o and 1/l.
+const recoveryAlphabet = "23456789abcdefghjkmnpqrstuvwxyz"
+
+// GenerateRecoveryCodes returns n random one-time recovery codes of the form
+// "xxxxx-xxxxx". They are shown to the user once; only their hashes are kept.
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+
+	for i := range codes {
+		b := make([]byte, 10)
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, err
+		}
+
+		// The modulo makes a few characters slightly more likely, which is
+		// negligible for codes with about 50 bits of entropy.
+		for j := range b {
+			b[j] = recoveryAlphabet[int(b[j])%len(recoveryAlphabet)]
+		}
+
+		codes[i] = string(b[:5]) + "-" + string(b[5:])
+	}
+
+	return codes, nil
+}
+
+// HashRecoveryCode returns the hash of a recovery code for storage. The codes
+// are random rather than chosen by the user, so a fast hash is enough.
+func HashRecoveryCode(code string) []byte {
+	sum := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	return sum[:]
+}
+
+// MatchRecoveryCode returns the index of the hash matching the code, or -1 if
+// there is none. The caller must delete the matched hash so the code can't be
+// used again.
+func MatchRecoveryCode(code string, hashes [][]byte) int {
+	hash := HashRecoveryCode(code)
+
+	match := -1
+	for i, h := range hashes {
+		if subtle.ConstantTimeCompare(h, hash) == 1 {
+			match = i
+		}
+	}
+	return match
+}
+
+// normalizeRecoveryCode ignores case, spaces and dashes.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,134 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Codes are 6 digits long and change every 30 seconds, which is what every
+// common authenticator app expects.
+const (
+	Digits = 6
+	Period = 30 * time.Second
+)
+
+// Skew is the number of periods either side of the current one in which a
+// code is still accepted, to allow for clock drift.
+const Skew = 1
+
+var ErrInvalidSecret = errors.New("totp: invalid secret")
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a new random 160-bit secret, base32 encoded as
+// authenticator apps expect.
+func GenerateSecret() (string, error) {
+	b := make([]byte, 20)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+// URI returns the otpauth:// URI used to enroll the secret in an
+// authenticator app, either directly or encoded as a QR code.
+func URI(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(Digits))
+	v.Set("period", fmt.Sprint(int(Period.Seconds())))
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: v.Encode(),
+	}
+	return u.String()
+}
+
+// Code returns the code for the secret at time t.
+func Code(secret string, t time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, counter(t)), nil
+}
+
+// Validate checks a code entered by the user against the secret at time t,
+// allowing for Skew. It returns the time step the code belongs to, which
+// callers should store and pass back as lastStep so that a code can only be
+// used once; pass -1 if no code has been used yet.
+func Validate(secret, code string, t time.Time, lastStep int64) (int64, bool) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return 0, false
+	}
+
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != Digits {
+		return 0, false
+	}
+
+	now := counter(t)
+	for step := now - Skew; step <= now+Skew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if hmac.Equal([]byte(hotp(key, step)), []byte(code)) {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// counter returns the RFC 6238 time step for t.
+func counter(t time.Time) int64 {
+	return t.Unix() / int64(Period.Seconds())
+}
+
+// hotp computes an RFC 4226 HOTP value.
+func hotp(key []byte, step int64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < Digits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", Digits, value%mod)
+}
+
+// decodeSecret accepts secrets with or without padding, in either case and
+// with spaces, as they are often written down.
+func decodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	secret = strings.TrimRight(secret, "=")
+
+	key, err := encoding.DecodeString(secret)
+	if err != nil || len(key) == 0 {
+		return nil, ErrInvalidSecret
+	}
+	return key, nil
+}
@@ -0,0 +1,125 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key from the RFC 6238 test vectors.
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// The last 6 digits of the 8-digit RFC 6238 SHA-1 test vectors.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Code at %d = %q; want %q", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2024, 3, 1, 12, 0, 10, 0, time.UTC)
+
+	code, _ := Code(secret, now.Add(-Period))
+	step, ok := Validate(secret, code, now, -1)
+	if !ok {
+		t.Fatal("code from the previous period was rejected")
+	}
+	if step != counter(now)-1 {
+		t.Errorf("step = %d; want %d", step, counter(now)-1)
+	}
+
+	if _, ok := Validate(secret, code, now, step); ok {
+		t.Error("code was accepted twice")
+	}
+
+	old, _ := Code(secret, now.Add(-3*Period))
+	if _, ok := Validate(secret, old, now, -1); ok {
+		t.Error("code from three periods ago was accepted")
+	}
+
+	if _, ok := Validate(secret, "12345", now, -1); ok {
+		t.Error("short code was accepted")
+	}
+
+	if _, ok := Validate("not base32!", "123456", now, -1); ok {
+		t.Error("code was accepted for an invalid secret")
+	}
+
+	// Secrets copied by hand may be lowercase and spaced.
+	spaced := strings.ToLower(secret[:4] + " " + secret[4:])
+	current, _ := Code(secret, now)
+	if _, ok := Validate(spaced, current, now, -1); !ok {
+		t.Error("code rejected for a lowercase, spaced secret")
+	}
+}
+
+func TestURI(t *testing.T) {
+	u, err := url.Parse(URI("Snippetbox", "alice@example.com", "JBSWY3DPEHPK3PXP"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Snippetbox:alice@example.com" {
+		t.Errorf("got %s", u)
+	}
+
+	q := u.Query()
+	if q.Get("secret") != "JBSWY3DPEHPK3PXP" || q.Get("issuer") != "Snippetbox" || q.Get("digits") != "6" || q.Get("period") != "30" {
+		t.Errorf("query = %v", q)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hashes := make([][]byte, len(codes))
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("code %q is not of the form xxxxx-xxxxx", code)
+		}
+		if seen[code] {
+			t.Errorf("duplicate code %q", code)
+		}
+		seen[code] = true
+		hashes[i] = HashRecoveryCode(code)
+	}
+
+	// Codes typed back in may differ in case and separators.
+	typed := strings.ToUpper(strings.Replace(codes[3], "-", " ", 1))
+	if i := MatchRecoveryCode(typed, hashes); i != 3 {
+		t.Errorf("MatchRecoveryCode = %d; want 3", i)
+	}
+
+	if i := MatchRecoveryCode("aaaaa-aaaaa", hashes); i != -1 {
+		t.Errorf("MatchRecoveryCode for an unknown code = %d; want -1", i)
+	}
+}
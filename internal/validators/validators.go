@@ -1,18 +1,48 @@
 package validator
 
 import (
+	"cmp"
+	"fmt"
+	"maps"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"unicode/utf8"
 )
 
-// Validator type contains a map of validation errors for form fields.
+// EmailRX matches a sanity-checked email address, using the pattern recommended
+// by the W3C and Web Hypertext Application Technology Working Group.
+var EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
+
+// TagRX matches a valid snippet tag: lowercase letters, digits and the
+// characters + # . - , starting with a letter or digit.
+var TagRX = regexp.MustCompile(`^[a-z0-9][a-z0-9+#.-]*$`)
+
+// Validator type contains the validation errors of a form, and is embedded
+// in every form struct. Field errors are keyed by the name of the form field,
+// while non-field errors are about the form as a whole. Templates read field
+// errors with FieldError. Marshalled to JSON, a Validator holds the same
+// messages under the same keys, but not the rules which failed.
 type Validator struct {
-	FieldErrors map[string]string
+	FieldErrors    map[string]string `json:"field_errors,omitempty"`
+	NonFieldErrors []string          `json:"non_field_errors,omitempty"`
 }
 
-// Valid() returns true if the FieldErrors map doesn't contain any entries.
+// Valid() returns true if there are no field or non-field errors.
 func (v *Validator) Valid() bool {
-	return len(v.FieldErrors) == 0
+	return len(v.FieldErrors) == 0 && len(v.NonFieldErrors) == 0
+}
+
+// FieldError() returns the error message for a field, or "" if it has none.
+// Templates use it as .Form.FieldError "title"; unlike indexing FieldErrors,
+// calling it on a form which doesn't embed a Validator is an error rather
+// than an empty result. It has a value receiver because templates get forms
+// by value.
+func (v Validator) FieldError(key string) string {
+	return v.FieldErrors[key]
 }
 
 // AddFieldError() adds an error message to the FieldErrors map (if the key doesn't already exist).
@@ -25,6 +55,11 @@ func (v *Validator) AddFieldError(key, message string) {
 	}
 }
 
+// AddNonFieldError() adds an error message which isn't about a single field.
+func (v *Validator) AddNonFieldError(message string) {
+	v.NonFieldErrors = append(v.NonFieldErrors, message)
+}
+
 // CheckField() adds an error message to the FieldErrors map only if a validation check fails.
 func (v *Validator) CheckField(ok bool, key, message string) {
 	if !ok {
@@ -32,22 +67,231 @@ func (v *Validator) CheckField(ok bool, key, message string) {
 	}
 }
 
+// Check() adds a non-field error message only if a validation check fails.
+func (v *Validator) Check(ok bool, message string) {
+	if !ok {
+		v.AddNonFieldError(message)
+	}
+}
+
 // NotBlank() returns true if a value is not an empty string.
 func NotBlank(value string) bool {
 	return strings.TrimSpace(value) != ""
 }
 
+// MinChars() returns true if a value contains at least n characters.
+func MinChars(value string, n int) bool {
+	return utf8.RuneCountInString(value) >= n
+}
+
 // MaxChars() returns true if a value contains no more than n characters.
 func MaxChars(value string, n int) bool {
 	return utf8.RuneCountInString(value) <= n
 }
 
-// PermittedInt() returns true if a value is in a list of permitted integers.
-func PermittedInt(value int, permittedValues ...int) bool {
-	for _, permittedValue := range permittedValues {
-		if value == permittedValue {
-			return true
+// MaxBytes() returns true if a value is no longer than n bytes.
+func MaxBytes(value string, n int) bool {
+	return len(value) <= n
+}
+
+// Between() returns true if a value is between low and high, inclusive.
+func Between[T cmp.Ordered](value, low, high T) bool {
+	return value >= low && value <= high
+}
+
+// PermittedValue() returns true if a value is in a list of permitted values.
+func PermittedValue[T comparable](value T, permittedValues ...T) bool {
+	return slices.Contains(permittedValues, value)
+}
+
+// Unique() returns true if no two values have the same key, as returned by
+// the key function, such as the name of each file in a list.
+func Unique[T any, K comparable](values []T, key func(T) K) bool {
+	seen := make(map[K]bool, len(values))
+	for _, value := range values {
+		k := key(value)
+		if seen[k] {
+			return false
+		}
+		seen[k] = true
+	}
+	return true
+}
+
+// Matches() returns true if a value matches a provided compiled regular expression pattern.
+func Matches(value string, rx *regexp.Regexp) bool {
+	return rx.MatchString(value)
+}
+
+// Email() returns true if a value looks like an email address which fits in
+// the 254 characters SMTP allows.
+func Email(value string) bool {
+	return len(value) <= 254 && EmailRX.MatchString(value)
+}
+
+// URL() returns true if a value is an absolute http or https URL.
+func URL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// A MessageFunc returns the error message for a field which failed a rule in
+// its validate tag, given the name of the rule, such as "max_chars", and its
+// parameters, such as 100.
+type MessageFunc func(rule string, params ...any) string
+
+// rule checks the value of a field against a rule in its validate tag.
+type rule func(field reflect.Value, params []any) bool
+
+// rules are the rules validate tags can use. Apart from required, rules on
+// strings pass for empty strings, so that optional fields only have to be
+// valid once they are filled in.
+var rules = map[string]rule{
+	"required": func(field reflect.Value, _ []any) bool {
+		if field.Kind() == reflect.Slice {
+			return field.Len() > 0
+		}
+		return NotBlank(stringValue(field))
+	},
+	"min_chars": stringRule(func(s string, params []any) bool {
+		return MinChars(s, intParam(params, 0))
+	}),
+	"max_chars": stringRule(func(s string, params []any) bool {
+		return MaxChars(s, intParam(params, 0))
+	}),
+	"max_bytes": stringRule(func(s string, params []any) bool {
+		return MaxBytes(s, intParam(params, 0))
+	}),
+	"email": stringRule(func(s string, _ []any) bool {
+		return Email(s)
+	}),
+	"url": stringRule(func(s string, _ []any) bool {
+		return URL(s)
+	}),
+	"one_of": stringRule(func(s string, params []any) bool {
+		for _, p := range params {
+			if fmt.Sprint(p) == s {
+				return true
+			}
+		}
+		return false
+	}),
+	"min": intRule(func(n int, params []any) bool {
+		return n >= intParam(params, 0)
+	}),
+	"max": intRule(func(n int, params []any) bool {
+		return n <= intParam(params, 0)
+	}),
+	"between": intRule(func(n int, params []any) bool {
+		return Between(n, intParam(params, 0), intParam(params, 1))
+	}),
+}
+
+// Rules returns the names of the rules validate tags can use. Each of them
+// needs an error message.
+func Rules() []string {
+	return slices.Sorted(maps.Keys(rules))
+}
+
+// CheckStruct() checks the fields of form, a pointer to a struct, against the
+// rules in their validate tags, such as `validate:"required,max_chars=100"`,
+// and adds a field error for the first rule a field fails. Errors are keyed
+// by the name in the form tag. Fields holding a struct, or a slice of them,
+// are checked too, with keys such as "files[0].name". Unknown rules panic,
+// since they are mistakes in the form rather than in the data.
+func (v *Validator) CheckStruct(form any, message MessageFunc) {
+	v.checkStruct(reflect.Indirect(reflect.ValueOf(form)), "", message)
+}
+
+func (v *Validator) checkStruct(s reflect.Value, prefix string, message MessageFunc) {
+	t := s.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("form"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		key := prefix + name
+		value := s.Field(i)
+
+		switch {
+		case value.Kind() == reflect.Struct:
+			v.checkStruct(value, key+".", message)
+		case value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Struct:
+			for j := 0; j < value.Len(); j++ {
+				v.checkStruct(value.Index(j), fmt.Sprintf("%s[%d].", key, j), message)
+			}
+		}
+
+		tag := field.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+		for _, r := range strings.Split(tag, ",") {
+			ruleName, arg, _ := strings.Cut(r, "=")
+			check, ok := rules[ruleName]
+			if !ok {
+				panic(fmt.Sprintf("validator: unknown rule %q on %s.%s", ruleName, t.Name(), field.Name))
+			}
+			params := parseParams(arg)
+			if !check(value, params) {
+				v.AddFieldError(key, message(ruleName, params...))
+				break
+			}
+		}
+	}
+}
+
+// parseParams splits the parameters of a rule at spaces. Parameters which
+// are integers are returned as ints, so that messages can use them as counts.
+func parseParams(arg string) []any {
+	var params []any
+	for _, p := range strings.Fields(arg) {
+		if n, err := strconv.Atoi(p); err == nil {
+			params = append(params, n)
+		} else {
+			params = append(params, p)
+		}
+	}
+	return params
+}
+
+// stringRule returns a rule for string fields, which passes if the field is empty.
+func stringRule(check func(s string, params []any) bool) rule {
+	return func(field reflect.Value, params []any) bool {
+		s := stringValue(field)
+		return s == "" || check(s, params)
+	}
+}
+
+// intRule returns a rule for integer fields.
+func intRule(check func(n int, params []any) bool) rule {
+	return func(field reflect.Value, params []any) bool {
+		if !field.CanInt() {
+			panic(fmt.Sprintf("validator: rule for integers used on a %s field", field.Type()))
+		}
+		return check(int(field.Int()), params)
+	}
+}
+
+// stringValue returns the value of a string field.
+func stringValue(field reflect.Value) string {
+	if field.Kind() != reflect.String {
+		panic(fmt.Sprintf("validator: rule for strings used on a %s field", field.Type()))
+	}
+	return field.String()
+}
+
+// intParam returns the i-th parameter of a rule, which must be an integer.
+func intParam(params []any, i int) int {
+	if i < len(params) {
+		if n, ok := params[i].(int); ok {
+			return n
 		}
 	}
-	return false
+	panic(fmt.Sprintf("validator: rule needs an integer parameter %d, got %v", i+1, params))
 }
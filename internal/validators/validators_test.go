@@ -0,0 +1,190 @@
+package validator
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestPredicates(t *testing.T) {
+	tests := []struct {
+		name string
+		got  bool
+		want bool
+	}{
+		{"NotBlank spaces", NotBlank("  \t"), false},
+		{"MinChars runes", MinChars("äöü", 3), true},
+		{"MinChars short", MinChars("ab", 3), false},
+		{"MaxChars runes", MaxChars("äöü", 3), true},
+		{"MaxBytes runes", MaxBytes("äöü", 3), false},
+		{"Between inside", Between(5, 0, 10), true},
+		{"Between edge", Between("b", "a", "b"), true},
+		{"Between outside", Between(1.5, 2, 3), false},
+		{"PermittedValue int", PermittedValue(2, 1, 2, 3), true},
+		{"PermittedValue string", PermittedValue("go", "c", "sql"), false},
+		{"Email", Email("alice@example.com"), true},
+		{"Email without domain", Email("alice@"), false},
+		{"Email too long", Email(strings.Repeat("a", 250) + "@example.com"), false},
+		{"URL", URL("https://example.com/path"), true},
+		{"URL without scheme", URL("example.com"), false},
+		{"URL with other scheme", URL("javascript://example.com"), false},
+		{"URL without host", URL("http://"), false},
+	}
+
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %t; want %t", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestUnique(t *testing.T) {
+	type file struct{ name string }
+	name := func(f file) string { return strings.ToLower(f.name) }
+
+	if !Unique([]file{{"a.go"}, {"b.go"}}, name) {
+		t.Error("got false for different names")
+	}
+	if Unique([]file{{"a.go"}, {"b.go"}, {"A.go"}}, name) {
+		t.Error("got true for names with the same key")
+	}
+	if !Unique(nil, name) {
+		t.Error("got false for no values")
+	}
+}
+
+type testFileForm struct {
+	Name    string `form:"name" validate:"max_chars=5"`
+	Content string `form:"content" validate:"required"`
+}
+
+type testForm struct {
+	Title     string         `form:"title" validate:"required,max_chars=10"`
+	Email     string         `form:"email" validate:"email"`
+	Website   string         `form:"website" validate:"url"`
+	Color     string         `form:"color" validate:"one_of=red green"`
+	Code      string         `form:"code" validate:"min_chars=3"`
+	Count     int            `form:"count" validate:"between=1 5"`
+	Files     []testFileForm `form:"files" validate:"required"`
+	Untagged  string
+	Validator Validator `form:"-"`
+}
+
+// message formats rule failures so that the tests can see the parameters.
+func message(rule string, params ...any) string {
+	return strings.TrimSpace(fmt.Sprintln(append([]any{rule}, params...)...))
+}
+
+func TestCheckStruct(t *testing.T) {
+	tests := []struct {
+		name string
+		form testForm
+		want map[string]string
+	}{
+		{
+			name: "Valid",
+			form: testForm{Title: "Hello", Count: 1, Files: []testFileForm{{Name: "a.go", Content: "x"}}},
+			want: map[string]string{},
+		},
+		{
+			name: "Optional fields filled in",
+			form: testForm{Title: "Hello", Email: "a@example.com", Website: "https://example.com", Color: "green", Code: "abc", Count: 5, Files: []testFileForm{{Content: "x"}}},
+			want: map[string]string{},
+		},
+		{
+			name: "Invalid",
+			form: testForm{
+				Title:   " ",
+				Email:   "nope",
+				Website: "example.com",
+				Color:   "blue",
+				Code:    "ab",
+				Count:   6,
+				Files:   []testFileForm{{Name: "a.go", Content: "x"}, {Name: "toolong.go"}},
+			},
+			want: map[string]string{
+				"title":            "required",
+				"email":            "email",
+				"website":          "url",
+				"color":            "one_of red green",
+				"code":             "min_chars 3",
+				"count":            "between 1 5",
+				"files[1].name":    "max_chars 5",
+				"files[1].content": "required",
+			},
+		},
+		{
+			name: "Missing",
+			form: testForm{Title: "", Count: 0},
+			want: map[string]string{
+				"title": "required",
+				"count": "between 1 5",
+				"files": "required",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.form.Validator.CheckStruct(&tt.form, message)
+
+			got := tt.form.Validator.FieldErrors
+			if got == nil {
+				got = map[string]string{}
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("got errors %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckStructUnknownRule(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("got no panic for an unknown rule")
+		}
+	}()
+
+	var form struct {
+		Name string `form:"name" validate:"shiny"`
+	}
+	var v Validator
+	v.CheckStruct(&form, message)
+}
+
+func TestNonFieldErrors(t *testing.T) {
+	var v Validator
+
+	v.Check(true, "not added")
+	if !v.Valid() {
+		t.Fatal("got invalid after a passing check")
+	}
+
+	v.Check(false, "The comment you replied to is gone")
+	if v.Valid() {
+		t.Error("got valid with a non-field error")
+	}
+
+	v.CheckField(false, "body", "This field cannot be blank")
+	v.CheckField(false, "body", "Not added either")
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"field_errors":{"body":"This field cannot be blank"},"non_field_errors":["The comment you replied to is gone"]}`
+	if string(b) != want {
+		t.Errorf("got JSON %s; want %s", b, want)
+	}
+
+	b, err = json.Marshal(Validator{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "{}" {
+		t.Errorf("got JSON %s for no errors; want {}", b)
+	}
+}
@@ -0,0 +1,3 @@
+-- Optional password protection for snippets. Only the bcrypt hash is stored;
+-- NULL means the snippet has no password.
+ALTER TABLE snippets ADD COLUMN hashed_password CHAR(60) NULL;
@@ -0,0 +1,3 @@
+-- Optional view limit for snippets. NULL means the snippet can be viewed any
+-- number of times; the row is deleted when the count reaches zero.
+ALTER TABLE snippets ADD COLUMN remaining_views INT NULL;
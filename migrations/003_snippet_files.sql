@@ -0,0 +1,18 @@
+-- Snippets are made up of one or more named files.
+CREATE TABLE snippet_files (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    snippet_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    language VARCHAR(50) NOT NULL,
+    content MEDIUMTEXT NOT NULL,
+    CONSTRAINT fk_snippet_files_snippet FOREIGN KEY (snippet_id) REFERENCES snippets (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_snippet_files_snippet ON snippet_files (snippet_id, position);
+
+-- Move the content of existing snippets into a single file each.
+INSERT INTO snippet_files (snippet_id, position, name, language, content)
+SELECT id, 0, 'snippet.txt', 'text', content FROM snippets;
+
+ALTER TABLE snippets DROP COLUMN content;
@@ -0,0 +1,17 @@
+-- Tags categorise snippets. A snippet can have many tags and a tag can be
+-- used by many snippets.
+CREATE TABLE tags (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    name VARCHAR(30) NOT NULL,
+    CONSTRAINT uc_tags_name UNIQUE (name)
+);
+
+CREATE TABLE snippet_tags (
+    snippet_id INTEGER NOT NULL,
+    tag_id INTEGER NOT NULL,
+    PRIMARY KEY (snippet_id, tag_id),
+    CONSTRAINT fk_snippet_tags_snippet FOREIGN KEY (snippet_id) REFERENCES snippets (id) ON DELETE CASCADE,
+    CONSTRAINT fk_snippet_tags_tag FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_snippet_tags_tag ON snippet_tags (tag_id);
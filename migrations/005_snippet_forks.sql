@@ -0,0 +1,6 @@
+-- Forks remember the snippet they were copied from. There is deliberately no
+-- foreign key: the reference is kept after the parent expires or is deleted,
+-- so the fork can still say where it came from.
+ALTER TABLE snippets ADD COLUMN forked_from INTEGER NULL;
+
+CREATE INDEX idx_snippets_forked_from ON snippets (forked_from);
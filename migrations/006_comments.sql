@@ -0,0 +1,19 @@
+-- Comments on snippets. A comment can reply to another comment and can be
+-- anchored to a range of lines in one of the snippet's files.
+CREATE TABLE comments (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    snippet_id INTEGER NOT NULL,
+    parent_id INTEGER NULL,
+    file_id INTEGER NULL,
+    line_start INTEGER NULL,
+    line_end INTEGER NULL,
+    author VARCHAR(50) NOT NULL,
+    body TEXT NOT NULL,
+    created DATETIME NOT NULL,
+    hidden BOOLEAN NOT NULL DEFAULT FALSE,
+    CONSTRAINT fk_comments_snippet FOREIGN KEY (snippet_id) REFERENCES snippets (id) ON DELETE CASCADE,
+    CONSTRAINT fk_comments_parent FOREIGN KEY (parent_id) REFERENCES comments (id) ON DELETE CASCADE,
+    CONSTRAINT fk_comments_file FOREIGN KEY (file_id) REFERENCES snippet_files (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_comments_snippet ON comments (snippet_id, id);
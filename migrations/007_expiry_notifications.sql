@@ -0,0 +1,10 @@
+-- Optional email reminder before a snippet expires. notified_at is set when
+-- the reminder is claimed for sending, so it goes out once per snippet. The
+-- reminder contains a token, stored hashed, which lets the recipient manage
+-- the snippet.
+ALTER TABLE snippets
+    ADD COLUMN notify_email VARCHAR(254) NULL,
+    ADD COLUMN notified_at DATETIME NULL,
+    ADD COLUMN manage_token_hash BINARY(32) NULL;
+
+CREATE INDEX idx_snippets_notify ON snippets (notified_at, expires);
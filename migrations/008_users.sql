@@ -0,0 +1,20 @@
+-- Local user accounts. Users log in through an OpenID Connect provider; each
+-- identity (issuer and subject) is linked to exactly one local user, and a
+-- user may have identities from several issuers.
+CREATE TABLE users (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    name VARCHAR(255) NOT NULL,
+    email VARCHAR(254) NULL,
+    created DATETIME NOT NULL,
+    last_login DATETIME NULL,
+    CONSTRAINT users_uc_email UNIQUE (email)
+);
+
+CREATE TABLE user_identities (
+    issuer VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    user_id INTEGER NOT NULL,
+    created DATETIME NOT NULL,
+    PRIMARY KEY (issuer, subject),
+    CONSTRAINT fk_user_identities_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
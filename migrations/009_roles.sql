@@ -0,0 +1,6 @@
+-- Roles and account status for users.
+ALTER TABLE users
+    ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user',
+    ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX idx_snippets_created ON snippets (created);
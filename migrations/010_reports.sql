@@ -0,0 +1,36 @@
+-- Abuse reports and moderation. A snippet can be hidden by moderators, or
+-- automatically once enough people report it. Each reporter (a user, or a
+-- client IP for visitors who aren't logged in) can report a snippet once;
+-- reporter_key is a hash of that identity.
+ALTER TABLE snippets
+    ADD COLUMN hidden BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE reports (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    snippet_id INTEGER NOT NULL,
+    reason VARCHAR(20) NOT NULL,
+    details VARCHAR(1000) NOT NULL,
+    reporter_key BINARY(32) NOT NULL,
+    created DATETIME NOT NULL,
+    resolved DATETIME NULL,
+    resolution VARCHAR(20) NULL,
+    CONSTRAINT reports_uc_reporter UNIQUE (snippet_id, reporter_key),
+    CONSTRAINT fk_reports_snippet FOREIGN KEY (snippet_id) REFERENCES snippets (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_reports_open ON reports (resolved, snippet_id);
+
+-- Audit trail of moderation actions. Rows are kept after the snippet or user
+-- they refer to is deleted, so there are no foreign keys on those columns.
+-- moderator_id is NULL for actions taken automatically.
+CREATE TABLE moderation_actions (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    moderator_id INTEGER NULL,
+    action VARCHAR(20) NOT NULL,
+    snippet_id INTEGER NULL,
+    target_user_id INTEGER NULL,
+    note VARCHAR(255) NOT NULL,
+    created DATETIME NOT NULL
+);
+
+CREATE INDEX idx_moderation_actions_created ON moderation_actions (created);
@@ -0,0 +1,26 @@
+-- Security audit log. Events are only ever added: the triggers reject updates
+-- and deletes, and the application's database user only needs INSERT and
+-- SELECT on the table. There are no foreign keys, so events outlive the users
+-- and snippets they refer to. actor_id is NULL for events without a logged in
+-- user, such as failed logins and background jobs.
+CREATE TABLE audit_events (
+    id BIGINT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    created DATETIME(6) NOT NULL,
+    action VARCHAR(50) NOT NULL,
+    actor_id INTEGER NULL,
+    target VARCHAR(100) NOT NULL,
+    details VARCHAR(1000) NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    user_agent VARCHAR(255) NOT NULL,
+    request_id VARCHAR(64) NOT NULL
+);
+
+CREATE INDEX idx_audit_events_created ON audit_events (created);
+CREATE INDEX idx_audit_events_action ON audit_events (action, created);
+CREATE INDEX idx_audit_events_actor ON audit_events (actor_id, created);
+
+CREATE TRIGGER audit_events_no_update BEFORE UPDATE ON audit_events
+    FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_events is append-only';
+
+CREATE TRIGGER audit_events_no_delete BEFORE DELETE ON audit_events
+    FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_events is append-only';
@@ -0,0 +1,8 @@
+-- Comments are written by logged in users and show the name of their
+-- account. Comments from before accounts existed keep the name that was typed
+-- in with them; user_id is NULL for those, and for comments whose author was
+-- deleted.
+ALTER TABLE comments
+    ADD COLUMN user_id INTEGER NULL,
+    MODIFY author VARCHAR(50) NULL,
+    ADD CONSTRAINT fk_comments_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL;
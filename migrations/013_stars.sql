@@ -0,0 +1,15 @@
+-- Stars let users keep track of snippets they want to find again. Each user
+-- can star a snippet once. The index on created lets the weekly "most
+-- starred" list read only the last week's stars.
+CREATE TABLE stars (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    snippet_id INTEGER NOT NULL,
+    created DATETIME NOT NULL,
+    CONSTRAINT stars_uc_user_snippet UNIQUE (user_id, snippet_id),
+    CONSTRAINT fk_stars_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT fk_stars_snippet FOREIGN KEY (snippet_id) REFERENCES snippets (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_stars_snippet ON stars (snippet_id);
+CREATE INDEX idx_stars_created ON stars (created, snippet_id);
@@ -0,0 +1,25 @@
+-- Public profiles. Each user has a unique username for their profile URL,
+-- an optional bio and an optional avatar image, stored with its content type.
+-- Existing users get a username based on their ID.
+ALTER TABLE users
+    ADD COLUMN username VARCHAR(40) NULL,
+    ADD COLUMN bio VARCHAR(500) NOT NULL DEFAULT '',
+    ADD COLUMN avatar MEDIUMBLOB NULL,
+    ADD COLUMN avatar_type VARCHAR(20) NULL;
+
+UPDATE users SET username = CONCAT('user-', id);
+
+ALTER TABLE users
+    MODIFY username VARCHAR(40) NOT NULL,
+    ADD CONSTRAINT users_uc_username UNIQUE (username);
+
+-- Snippets record their author, if they were created logged in. Deleting a
+-- user keeps their snippets. Unlisted snippets can be seen by anyone with the
+-- link but aren't listed anywhere; private ones can only be seen by their
+-- author.
+ALTER TABLE snippets
+    ADD COLUMN user_id INTEGER NULL,
+    ADD COLUMN visibility VARCHAR(10) NOT NULL DEFAULT 'public',
+    ADD CONSTRAINT fk_snippets_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL;
+
+CREATE INDEX idx_snippets_user ON snippets (user_id, id);
@@ -0,0 +1,15 @@
+-- Two-factor authentication with authenticator apps. A user has a TOTP
+-- secret once they have confirmed it with a code. totp_last_step is the time
+-- step of the last code used, so that a code can't be used twice.
+ALTER TABLE users
+    ADD COLUMN totp_secret VARCHAR(64) NULL,
+    ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT -1;
+
+-- One-time recovery codes for users who lose their authenticator. Only the
+-- SHA-256 hashes are stored, and each row is deleted when its code is used.
+CREATE TABLE recovery_codes (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    code_hash BINARY(32) NOT NULL,
+    CONSTRAINT fk_recovery_codes_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
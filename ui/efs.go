@@ -0,0 +1,9 @@
+package ui
+
+import "embed"
+
+// Files holds the HTML templates, email templates, message catalogs and static
+// assets, so that the binary works whichever directory it is started from.
+//
+//go:embed "html" "locales" "mail" "static"
+var Files embed.FS
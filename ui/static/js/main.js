@@ -5,4 +5,87 @@ for (var i = 0; i < navLinks.length; i++) {
 		link.classList.add("live");
 		break;
 	}
-}
\ No newline at end of file
+}
+
+// Default empty time zone fields to the browser's time zone.
+var timezone = Intl.DateTimeFormat().resolvedOptions().timeZone;
+var timezoneInputs = document.querySelectorAll("input.timezone");
+for (var i = 0; i < timezoneInputs.length; i++) {
+	if (timezoneInputs[i].value == "" && timezone) {
+		timezoneInputs[i].value = timezone;
+	}
+}
+
+// Tell the server the browser's time zone, which dates are shown in unless
+// another one was chosen in the footer. It takes effect from the next page.
+if (timezone && document.cookie.split("; ").indexOf("timezone=" + timezone) == -1) {
+	document.cookie = "timezone=" + timezone + "; path=/; max-age=31536000; samesite=lax";
+}
+
+
+// Renumber the file entries on the create form so their field names stay
+// sequential (files[0].name, files[1].name, ...) after adding or removing one.
+function renumberFiles() {
+	var fieldsets = document.querySelectorAll("fieldset.file");
+	for (var i = 0; i < fieldsets.length; i++) {
+		var fields = fieldsets[i].querySelectorAll("[name]");
+		for (var j = 0; j < fields.length; j++) {
+			fields[j].name = fields[j].name.replace(/^files\[\d+\]/, "files[" + i + "]");
+		}
+	}
+}
+
+document.addEventListener("click", function(event) {
+	var target = event.target;
+
+	if (target.classList.contains("add-file")) {
+		var fieldsets = document.querySelectorAll("fieldset.file");
+		var last = fieldsets[fieldsets.length - 1];
+		var copy = last.cloneNode(true);
+
+		// Clear the copied values and error messages.
+		var errors = copy.querySelectorAll(".error");
+		for (var i = 0; i < errors.length; i++) {
+			errors[i].remove();
+		}
+		copy.querySelector("input").value = "";
+		copy.querySelector("textarea").value = "";
+
+		last.after(copy);
+		renumberFiles();
+	}
+
+	if (target.classList.contains("remove-file")) {
+		// Always keep at least one file entry.
+		if (document.querySelectorAll("fieldset.file").length > 1) {
+			target.closest("fieldset.file").remove();
+			renumberFiles();
+		}
+	}
+});
+
+
+// Clicking a line number fills in the line range of the comment form.
+// Shift-click extends the range from the previously selected line.
+document.addEventListener("click", function(event) {
+	var link = event.target.closest("td.line-number a");
+	var form = document.getElementById("comment-form");
+	if (!link || !form) {
+		return;
+	}
+
+	var table = link.closest("table.code");
+	var line = parseInt(link.textContent, 10);
+	var start = form.elements["line_start"];
+	var end = form.elements["line_end"];
+
+	if (event.shiftKey && form.elements["file_id"].value == table.dataset.fileId && start.value) {
+		var first = parseInt(start.value, 10);
+		start.value = Math.min(first, line);
+		end.value = Math.max(first, line);
+	} else {
+		start.value = line;
+		end.value = line;
+	}
+	form.elements["file_id"].value = table.dataset.fileId;
+});